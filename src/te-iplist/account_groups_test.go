@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+var testAccountGroups = []AccountGroup{
+	{ID: 10, Name: "Production", OrganizationName: "Acme", Default: true},
+	{ID: 20, Name: `Lab "EU", west`, OrganizationName: "Acme: Labs", Default: false},
+}
+
+func TestOutputAccountGroupsCSV(t *testing.T) {
+
+	var b bytes.Buffer
+	outputAccountGroupsCSV(&b, testAccountGroups)
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("outputAccountGroupsCSV() is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"AID", "Organization Name", "Account Group Name", "Default"},
+		{"10", "Acme", "Production", "true"},
+		{"20", "Acme: Labs", `Lab "EU", west`, "false"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("outputAccountGroupsCSV() = %q, want %q", records, want)
+	}
+	for i := range want {
+		if !slices.Equal(records[i], want[i]) {
+			t.Errorf("outputAccountGroupsCSV() row %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+
+}
+
+func TestOutputAccountGroupsYAML(t *testing.T) {
+
+	tests := []struct {
+		accountGroups []AccountGroup
+		want          string
+	}{
+		{accountGroups: []AccountGroup{}, want: "[]\n"},
+		{accountGroups: testAccountGroups, want: `- aid: 10
+  accountGroupName: "Production"
+  organizationName: "Acme"
+  isDefaultAccountGroup: true
+- aid: 20
+  accountGroupName: "Lab \"EU\", west"
+  organizationName: "Acme: Labs"
+  isDefaultAccountGroup: false
+`},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		outputAccountGroupsYAML(&b, test.accountGroups)
+		if b.String() != test.want {
+			t.Errorf("outputAccountGroupsYAML(%v) = %q, want %q", test.accountGroups, b.String(), test.want)
+		}
+	}
+
+}
+
+// JSON output uses the API field names and parses back to the Account Groups
+func TestOutputAccountGroupsJSON(t *testing.T) {
+
+	var b bytes.Buffer
+	outputAccountGroupsJSON(&b, testAccountGroups)
+
+	var parsed []struct {
+		ID               int    `json:"aid"`
+		Name             string `json:"accountGroupName"`
+		OrganizationName string `json:"organizationName"`
+		Default          bool   `json:"isDefaultAccountGroup"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &parsed); err != nil {
+		t.Fatalf("outputAccountGroupsJSON() is not valid JSON: %v", err)
+	}
+	for i, a := range parsed {
+		if AccountGroup(a) != testAccountGroups[i] {
+			t.Errorf("outputAccountGroupsJSON()[%d] = %+v, want %+v", i, a, testAccountGroups[i])
+		}
+	}
+
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serves API requests with handler instead of the ThousandEyes API
+func mockAPI(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	defaultURL := apiURL
+	apiURL = server.URL
+	t.Cleanup(func() {
+		apiURL = defaultURL
+		server.Close()
+	})
+}
+
+func TestFetchAgentsAccountGroups(t *testing.T) {
+
+	// Agent 1 is available in Account Groups 10 and 20, Agent 2 only in 20
+	mockAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("aid") {
+		case "":
+			fmt.Fprint(w, `{"agents": [{"agentId": "1", "agentName": "Tokyo", "agentType": "cloud", "ipAddresses": ["192.0.2.1"]}]}`)
+		case "10":
+			fmt.Fprint(w, `{"agents": [{"agentId": "1", "agentName": "Tokyo", "agentType": "cloud", "ipAddresses": ["192.0.2.1"]}]}`)
+		case "20":
+			fmt.Fprint(w, `{"agents": [{"agentId": "2", "agentName": "Office", "agentType": "enterprise", "ipAddresses": ["198.51.100.7"]}, {"agentId": "1", "agentName": "Tokyo", "agentType": "cloud", "ipAddresses": ["192.0.2.1"]}]}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+
+	tests := []struct {
+		aids []string
+		want []string
+		err  string
+	}{
+		{aids: []string{Default}, want: []string{"1 Tokyo []"}},
+		{aids: []string{"10"}, want: []string{"1 Tokyo [10]"}},
+		// Agents available in multiple Account Groups are listed once, with all
+		// their Account Groups
+		{aids: []string{"10", "20"}, want: []string{"1 Tokyo [10 20]", "2 Office [20]"}},
+		{aids: []string{"20", "10"}, want: []string{"2 Office [20]", "1 Tokyo [20 10]"}},
+		{aids: []string{"10", "30", "20"}, err: "Account Group 30: Your account does not have permissions"},
+	}
+
+	for _, test := range tests {
+		agents, err := fetchAgents("token", test.aids, true, true, true, true, true, false, AgentFilter{})
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("fetchAgents(%v) error = %v, want %q", test.aids, err, test.err)
+			}
+			continue
+		}
+		got := []string{}
+		for _, agent := range agents {
+			got = append(got, fmt.Sprintf("%d %s %v", agent.AgentID, agent.AgentName, agent.AccountGroupIDs))
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("fetchAgents(%v) = %q, %v, want %q", test.aids, got, err, test.want)
+		}
+	}
+
+}
+
+func TestFetchConcurrently(t *testing.T) {
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	calls := make([]int, 10)
+	fetchConcurrently(len(calls), func(i int) {
+		mu.Lock()
+		calls[i]++
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if slices.ContainsFunc(calls, func(n int) bool { return n != 1 }) {
+		t.Errorf("fetchConcurrently() calls per index = %v, want 1 each", calls)
+	}
+	if maxRunning > MaxConcurrentRequests || maxRunning < 2 {
+		t.Errorf("fetchConcurrently() ran %d calls at a time, want 2 to %d", maxRunning, MaxConcurrentRequests)
+	}
+
+	fetchConcurrently(0, func(i int) {
+		t.Errorf("fetchConcurrently(0) called fetch(%d)", i)
+	})
+
+}
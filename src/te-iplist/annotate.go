@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// AnnotateOptions control where the source IP of a log line is found and how
+// annotated lines are written
+type AnnotateOptions struct {
+	// Whitespace separated field holding the source IP, starting with 1
+	Field int
+	// Regular expression whose first capture group, or whole match, holds the
+	// source IP
+	Regex *regexp.Regexp
+	// Write JSON lines instead of appending a comment to log lines
+	JSON bool
+}
+
+// Agent fields identifying an Agent in annotated lines and manifests
+type AgentSummary struct {
+	AgentID   int    `json:"agentId"`
+	AgentName string `json:"agentName"`
+	AgentType string `json:"agentType"`
+}
+
+type AnnotatedLine struct {
+	Line   string         `json:"line"`
+	IP     string         `json:"ip,omitempty"`
+	Agents []AgentSummary `json:"agents,omitempty"`
+}
+
+// Annotates log lines read from files, or standard input if no file or "-" is
+// provided
+func annotateFiles(w io.Writer, paths []string, index *AgentIndex, opts AnnotateOptions) error {
+
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	for _, path := range paths {
+		if path == "-" {
+			if err := annotateLog(w, os.Stdin, index, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = annotateLog(w, f, index, opts)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// Streams log lines and appends name, ID and type of Agents the source IP
+// belongs to. Lines without an Agent source IP are written unchanged.
+func annotateLog(w io.Writer, r io.Reader, index *AgentIndex, opts AnnotateOptions) error {
+
+	reader := bufio.NewReader(r)
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				return writer.Flush()
+			}
+			writer.Flush()
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		var agents []Agent
+		ip, found := sourceIP(line, opts)
+		if found {
+			agents = index.ByIP(ip)
+		}
+
+		if opts.JSON {
+			annotatedLine := AnnotatedLine{Line: line}
+			if found {
+				annotatedLine.IP = ip.String()
+			}
+			for _, agent := range agents {
+				annotatedLine.Agents = append(annotatedLine.Agents, AgentSummary{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType})
+			}
+			err = encoder.Encode(annotatedLine)
+		} else if len(agents) > 0 {
+			agentsStr := []string{}
+			for _, agent := range agents {
+				agentsStr = append(agentsStr, fmt.Sprintf("%s (%d, %s)", agent.AgentName, agent.AgentID, agent.AgentType))
+			}
+			_, err = fmt.Fprintf(writer, "%s %s %s\n", line, ListCommentChar, strings.Join(agentsStr, ListSeparatorChar+" "))
+		} else {
+			_, err = fmt.Fprintf(writer, "%s\n", line)
+		}
+		// Flushed whenever reading the next line may wait for input, so lines
+		// streamed with i.e. tail -f are written as they arrive, while files are
+		// still written in large chunks
+		if err == nil && reader.Buffered() == 0 {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+}
+
+// Returns the source IP of a log line
+func sourceIP(line string, opts AnnotateOptions) (netip.Addr, bool) {
+
+	if opts.Field > 0 {
+		fields := strings.Fields(line)
+		if len(fields) < opts.Field {
+			return netip.Addr{}, false
+		}
+		line = fields[opts.Field-1]
+	} else if opts.Regex != nil {
+		match := opts.Regex.FindStringSubmatch(line)
+		if match == nil {
+			return netip.Addr{}, false
+		}
+		line = match[0]
+		if len(match) > 1 {
+			line = match[1]
+		}
+	}
+
+	ips := findIPs(line)
+	if len(ips) == 0 {
+		return netip.Addr{}, false
+	}
+	return ips[0], true
+
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateLog(t *testing.T) {
+
+	index := newAgentIndex([]Agent{
+		{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, IPv4Addresses: addrs("192.0.2.1")},
+		{AgentID: 2, AgentName: "Office", AgentType: Enterprise, IPv4Addresses: addrs("192.0.2.1"), IPv6Addresses: addrs("2001:db8::1")},
+	})
+
+	tests := []struct {
+		name string
+		log  string
+		opts AnnotateOptions
+		want string
+	}{
+		{
+			name: "first ip",
+			log:  "192.0.2.1 - - [01/Jan/2024] \"GET / HTTP/1.1\" 200\n",
+			want: "192.0.2.1 - - [01/Jan/2024] \"GET / HTTP/1.1\" 200 # Tokyo (1, cloud); Office (2, enterprise)\n",
+		},
+		{
+			name: "no ip",
+			log:  "starting server\n",
+			want: "starting server\n",
+		},
+		{
+			name: "not an agent ip",
+			log:  "198.51.100.7 GET /\n",
+			want: "198.51.100.7 GET /\n",
+		},
+		{
+			name: "field",
+			log:  "10.0.0.1 [2001:db8::1]:443 GET /\n10.0.0.1 192.0.2.1\n",
+			opts: AnnotateOptions{Field: 2},
+			want: "10.0.0.1 [2001:db8::1]:443 GET / # Office (2, enterprise)\n10.0.0.1 192.0.2.1 # Tokyo (1, cloud); Office (2, enterprise)\n",
+		},
+		{
+			name: "field missing",
+			log:  "192.0.2.1\n",
+			opts: AnnotateOptions{Field: 2},
+			want: "192.0.2.1\n",
+		},
+		{
+			name: "regex capture",
+			log:  "proxy=10.0.0.1 client=2001:db8::1 GET /\n",
+			opts: AnnotateOptions{Regex: regexp.MustCompile(`client=(\S+)`)},
+			want: "proxy=10.0.0.1 client=2001:db8::1 GET / # Office (2, enterprise)\n",
+		},
+		{
+			name: "regex without match",
+			log:  "proxy=192.0.2.1 GET /\n",
+			opts: AnnotateOptions{Regex: regexp.MustCompile(`client=(\S+)`)},
+			want: "proxy=192.0.2.1 GET /\n",
+		},
+		{
+			name: "json",
+			log:  "2001:db8::1 GET /<a>\n198.51.100.7 GET /\nstarting server\r\n",
+			opts: AnnotateOptions{JSON: true},
+			want: `{"line":"2001:db8::1 GET /<a>","ip":"2001:db8::1","agents":[{"agentId":2,"agentName":"Office","agentType":"enterprise"}]}` + "\n" +
+				`{"line":"198.51.100.7 GET /","ip":"198.51.100.7"}` + "\n" +
+				`{"line":"starting server"}` + "\n",
+		},
+		{
+			name: "last line without newline",
+			log:  "192.0.2.1",
+			opts: AnnotateOptions{Field: 1},
+			want: "192.0.2.1 # Tokyo (1, cloud); Office (2, enterprise)\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := annotateLog(&b, strings.NewReader(test.log), index, test.opts); err != nil {
+			t.Errorf("%s: annotateLog() error = %v", test.name, err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%s: annotateLog() = %q, want %q", test.name, b.String(), test.want)
+		}
+	}
+
+}
+
+// Lines streamed from a pipe are written as soon as they are read
+func TestAnnotateLogStream(t *testing.T) {
+
+	index := newAgentIndex([]Agent{{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, IPv4Addresses: addrs("192.0.2.1")}})
+	r, w := io.Pipe()
+	out := &chanWriter{written: make(chan string, 1)}
+	done := make(chan error)
+	go func() {
+		done <- annotateLog(out, r, index, AnnotateOptions{})
+	}()
+
+	w.Write([]byte("192.0.2.1 GET /\n"))
+	if line := <-out.written; line != "192.0.2.1 GET / # Tokyo (1, cloud)\n" {
+		t.Errorf("annotateLog() wrote %q", line)
+	}
+	w.Close()
+	if err := <-done; err != nil {
+		t.Errorf("annotateLog() error = %v", err)
+	}
+
+}
+
+type chanWriter struct {
+	written chan string
+}
+
+func (b *chanWriter) Write(p []byte) (int, error) {
+	b.written <- string(p)
+	return len(p), nil
+}
+
+func TestAnnotateLogWriteError(t *testing.T) {
+	index := newAgentIndex(nil)
+	err := annotateLog(failingWriter{}, strings.NewReader("192.0.2.1 GET /\n"), index, AnnotateOptions{})
+	if err == nil {
+		t.Errorf("annotateLog() to a failing writer returned no error")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
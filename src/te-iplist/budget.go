@@ -0,0 +1,345 @@
+package main
+
+import (
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// Merge subnets into supernets until there are at most maxEntries subnets,
+// admitting as few addresses not used by Agents as possible. Supernets that
+// cover excluded subnets, are wider than MinPrefixV4 or MinPrefixV6, or exceed
+// MaxOvercoverRatio are never created, opts are usually BudgetOptions.
+// maxEntries <= 0 disables the budget.
+// ipNets []netip.Prefix MUST be sorted and disjoint, as returned by
+// ipsToSubnets*()
+func budgetSubnets(ips []netip.Addr, ipNets []netip.Prefix, maxEntries int, opts LooseOptions) []netip.Prefix {
+
+	if maxEntries <= 0 || len(ipNets) == 0 {
+		return ipNets
+	}
+
+	// Only supernets that are the smallest common supernet of some subnets have
+	// to be considered, they form a binary trie with the subnets as leaves. The
+	// cost of covering every node with k subnets is calculated bottom-up, from
+	// the costs of its children.
+	leaves := []*budgetNode{}
+	j := 0
+	for _, ipNet := range ipNets {
+		leaf := &budgetNode{ipNet: ipNet.Masked(), fits: true}
+		for j < len(ips) && ips[j].Less(leaf.ipNet.Addr()) {
+			j++
+		}
+		for j < len(ips) && leaf.ipNet.Contains(ips[j]) {
+			leaf.hosts++
+			j++
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	// IPv4 and IPv6 subnets are never merged
+	var root *budgetNode
+	for _, family := range [][]*budgetNode{leaves[:countIPv4Subnets(ipNets)], leaves[countIPv4Subnets(ipNets):]} {
+		if len(family) == 0 {
+			continue
+		}
+		node := budgetTrie(family, opts)
+		if root != nil {
+			node = &budgetNode{left: root, right: node}
+		}
+		root = node
+	}
+	root.solve(maxEntries)
+
+	// Fewest addresses not used by Agents, and fewest entries among equals
+	entries := 0
+	for k, cost := range root.cost {
+		if cost.ok && (entries == 0 || cost.extra.cmp(root.cost[entries-1].extra) < 0) {
+			entries = k + 1
+		}
+	}
+	if entries == 0 {
+		entries = root.fewestEntries()
+		log.Error("Unable to reduce output below %d entries, IPv4 and IPv6 subnets, excluded subnets and subnets exceeding -min-prefix-v4, -min-prefix-v6 or -max-overcover-ratio can not be merged", entries)
+		ipNets = root.fewestSubnets()
+	} else {
+		ipNets = root.subnets(entries)
+	}
+
+	total := new(big.Int)
+	for _, ipNet := range ipNets {
+		total.Add(total, subnetSize(ipNet))
+	}
+	logExtraAddresses(len(ipNets), total, len(ips))
+
+	return ipNets
+
+}
+
+// Node of the trie of subnets merged by budgetSubnets. Leaves are the subnets,
+// other nodes are the smallest supernet of the subnets of both children.
+type budgetNode struct {
+	ipNet       netip.Prefix
+	hosts       int
+	left, right *budgetNode
+	// Node can be a single entry, leaves always can
+	fits bool
+	// cost[k-1] is the fewest addresses not used by Agents when subnets of the
+	// node are covered with k entries, split[k-1] the number of them covering
+	// subnets of the left child
+	cost  []budgetCost
+	split []int
+}
+
+type budgetCost struct {
+	extra uint128
+	ok    bool
+}
+
+// Builds the trie of subnets of the same IP version, as a Cartesian tree over
+// prefix lengths of smallest supernets of adjacent subnets
+func budgetTrie(leaves []*budgetNode, opts LooseOptions) *budgetNode {
+
+	minPrefix := opts.MinPrefixV4
+	if leaves[0].ipNet.Addr().Is6() {
+		minPrefix = opts.MinPrefixV6
+	}
+
+	// Nodes on the path from the root to the last leaf
+	path := []*budgetNode{leaves[0]}
+	for _, leaf := range leaves[1:] {
+		supernet := commonSupernet(path[len(path)-1].ipNet, leaf.ipNet)
+		node := &budgetNode{ipNet: supernet, right: leaf}
+		for len(path) > 0 && path[len(path)-1].ipNet.Bits() > supernet.Bits() {
+			node.left = path[len(path)-1]
+			path = path[:len(path)-1]
+		}
+		if len(path) > 0 {
+			path[len(path)-1].right = node
+		}
+		path = append(path, node, leaf)
+	}
+
+	var setHosts func(node *budgetNode)
+	setHosts = func(node *budgetNode) {
+		if node.left == nil {
+			return
+		}
+		setHosts(node.left)
+		setHosts(node.right)
+		node.hosts = node.left.hosts + node.right.hosts
+		node.fits = node.ipNet.Bits() >= minPrefix && !excludedSubnet(node.ipNet, opts.Exclude) &&
+			!opts.overcovered(node.hosts, node.ipNet.Addr().BitLen()-node.ipNet.Bits())
+	}
+	setHosts(path[0])
+
+	return path[0]
+
+}
+
+// Calculates costs of covering subnets of the node with 1 to maxEntries entries
+func (node *budgetNode) solve(maxEntries int) {
+
+	if node.left == nil {
+		node.cost = []budgetCost{{extra: node.extra(), ok: true}}
+		return
+	}
+	node.left.solve(maxEntries)
+	node.right.solve(maxEntries)
+
+	n := min(len(node.left.cost)+len(node.right.cost), maxEntries)
+	node.cost = make([]budgetCost, n)
+	node.split = make([]int, n)
+	if node.fits {
+		node.cost[0] = budgetCost{extra: node.extra(), ok: true}
+	}
+	for i, left := range node.left.cost {
+		for j, right := range node.right.cost {
+			k := i + j + 1
+			if k >= n {
+				break
+			}
+			if !left.ok || !right.ok {
+				continue
+			}
+			extra := left.extra.addSat(right.extra)
+			if !node.cost[k].ok || extra.cmp(node.cost[k].extra) < 0 {
+				node.cost[k] = budgetCost{extra: extra, ok: true}
+				node.split[k] = i + 1
+			}
+		}
+	}
+
+}
+
+// Addresses of the node not used by Agents
+func (node *budgetNode) extra() uint128 {
+	size := hostMask(node.ipNet.Addr().BitLen() - node.ipNet.Bits())
+	if node.hosts == 0 {
+		return size.addSat(uint128{0, 1})
+	}
+	return size.sub(uint128{0, uint64(node.hosts - 1)})
+}
+
+// Subnets covering subnets of the node with k entries
+func (node *budgetNode) subnets(k int) []netip.Prefix {
+	if k == 1 {
+		return []netip.Prefix{node.ipNet}
+	}
+	left := node.split[k-1]
+	return append(node.left.subnets(left), node.right.subnets(k-left)...)
+}
+
+// Fewest entries subnets of the node can be covered with
+func (node *budgetNode) fewestEntries() int {
+	if node.fits {
+		return 1
+	}
+	return node.left.fewestEntries() + node.right.fewestEntries()
+}
+
+func (node *budgetNode) fewestSubnets() []netip.Prefix {
+	if node.fits {
+		return []netip.Prefix{node.ipNet}
+	}
+	return append(node.left.fewestSubnets(), node.right.fewestSubnets()...)
+}
+
+// Number of IPv4 subnets, which are sorted before IPv6 subnets
+func countIPv4Subnets(ipNets []netip.Prefix) int {
+	n := 0
+	for n < len(ipNets) && ipNets[n].Addr().Is4() {
+		n++
+	}
+	return n
+}
+
+// Merge adjacent IP ranges separated by the smallest gaps until there are at
+// most maxEntries ranges. Gaps that contain excluded addresses are never
+// merged, and neither are ranges that would exceed MaxOvercoverRatio, MaxGap
+// for IPv4 or a MinPrefixV6 subnet for IPv6, opts are usually BudgetOptions.
+// maxEntries <= 0 disables the budget.
+// ipRanges []IPRange MUST be sorted, as returned by ipsToIPRanges*()
+func budgetIPRanges(ips []netip.Addr, ipRanges []IPRange, maxEntries int, opts LooseOptions) []IPRange {
+
+	if maxEntries <= 0 {
+		return ipRanges
+	}
+
+	type gap struct {
+		index int
+		size  *big.Int
+	}
+
+	gaps := []gap{}
+	for i := 0; i+1 < len(ipRanges); i++ {
+		if ipRanges[i].EndIP.Is4() != ipRanges[i+1].StartIP.Is4() ||
+			excludedRange(ipRanges[i].EndIP, ipRanges[i+1].StartIP, opts.Exclude) {
+			continue
+		}
+		size := new(big.Int).Sub(ipToInt(ipRanges[i+1].StartIP), ipToInt(ipRanges[i].EndIP))
+		gaps = append(gaps, gap{i, size.Sub(size, big.NewInt(1))})
+	}
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].size.Cmp(gaps[j].size) < 0
+	})
+
+	// Agent IPs before each range, so merged ranges know their number of IPs
+	hostsBefore := make([]int, len(ipRanges)+1)
+	j := 0
+	for i, ipRange := range ipRanges {
+		for j < len(ips) && ips[j].Less(ipRange.StartIP) {
+			j++
+		}
+		hostsBefore[i] = j
+	}
+	hostsBefore[len(ipRanges)] = len(ips)
+
+	// First and last range merged with range i, valid for the first and the
+	// last range of merged ranges
+	first := make([]int, len(ipRanges))
+	last := make([]int, len(ipRanges))
+	for i := range ipRanges {
+		first[i], last[i] = i, i
+	}
+
+	merges := len(ipRanges) - maxEntries
+	mergeWithNext := map[int]bool{}
+	for _, g := range gaps {
+		if len(mergeWithNext) >= merges {
+			break
+		}
+		a, b := first[g.index], last[g.index+1]
+		if !opts.rangeFits(IPRange{ipRanges[a].StartIP, ipRanges[b].EndIP}, hostsBefore[b+1]-hostsBefore[a]) {
+			continue
+		}
+		mergeWithNext[g.index] = true
+		first[b], last[a] = a, b
+	}
+	if merges > len(mergeWithNext) {
+		log.Error("Unable to reduce output below %d entries, IPv4 and IPv6 ranges, excluded ranges and ranges exceeding -max-gap, -min-prefix-v6 or -max-overcover-ratio can not be merged", len(ipRanges)-len(mergeWithNext))
+	}
+
+	budgetRanges := []IPRange{}
+	for i, ipRange := range ipRanges {
+		if i > 0 && mergeWithNext[i-1] {
+			budgetRanges[len(budgetRanges)-1].EndIP = ipRange.EndIP
+		} else {
+			budgetRanges = append(budgetRanges, ipRange)
+		}
+	}
+
+	total := new(big.Int)
+	for _, ipRange := range budgetRanges {
+		total.Add(total, ipRangeSize(ipRange))
+	}
+	logExtraAddresses(len(budgetRanges), total, len(ips))
+
+	return budgetRanges
+
+}
+
+// Returns true if a range created by -max-entries, holding hosts Agent IPs, is
+// within the limits of BudgetOptions
+func (opts LooseOptions) rangeFits(ipRange IPRange, hosts int) bool {
+	distance := uint128FromAddr(ipRange.EndIP).sub(uint128FromAddr(ipRange.StartIP))
+	if ipRange.StartIP.Is4() && opts.MaxGap > 0 && distance.lo >= uint64(max(hosts-1, 1))*uint64(opts.MaxGap) {
+		return false
+	}
+	if v6Subnet, _ := ipRange.StartIP.Prefix(opts.MinPrefixV6); ipRange.StartIP.Is6() && !v6Subnet.Contains(ipRange.EndIP) {
+		return false
+	}
+	return !opts.overcoveredRange(hosts, distance.float64()+1)
+}
+
+func logExtraAddresses(entries int, total *big.Int, ips int) {
+	extra := new(big.Int).Sub(total, big.NewInt(int64(ips)))
+	log.Info("%d entries cover %s addresses, %s of them not used by ThousandEyes Agents", entries, total.String(), extra.String())
+}
+
+// Smallest subnet that contains both subnets
+func commonSupernet(a, b netip.Prefix) netip.Prefix {
+
+	// IPv4 addresses are IPv4-mapped, the first 96 bits are always equal
+	commonLen := uint128FromAddr(a.Addr()).xor(uint128FromAddr(b.Addr())).leadingZeros() - (128 - a.Addr().BitLen())
+	commonLen = min(commonLen, a.Bits(), b.Bits())
+
+	supernet, _ := a.Addr().Prefix(commonLen)
+	return supernet
+
+}
+
+// Number of addresses in subnet
+func subnetSize(ipNet netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(ipNet.Addr().BitLen()-ipNet.Bits()))
+}
+
+// Number of addresses in IP range
+func ipRangeSize(ipRange IPRange) *big.Int {
+	size := new(big.Int).Sub(ipToInt(ipRange.EndIP), ipToInt(ipRange.StartIP))
+	return size.Add(size, big.NewInt(1))
+}
+
+func ipToInt(ip netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(ip.AsSlice())
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestBudgetSubnets(t *testing.T) {
+
+	unlimited := DefaultLooseOptions
+	unlimited.MinPrefixV4 = 0
+	unlimited.MinPrefixV6 = 0
+	halfUsed := unlimited
+	halfUsed.MaxOvercoverRatio = 0.5
+	excluded := unlimited
+	excluded.Exclude = prefixes("10.0.0.2/32")
+
+	tests := []struct {
+		name       string
+		ips        []netip.Addr
+		maxEntries int
+		opts       LooseOptions
+		want       []netip.Prefix
+	}{
+		{
+			name:       "disabled",
+			ips:        addrs("10.0.0.1", "10.0.0.3"),
+			maxEntries: 0,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.1/32", "10.0.0.3/32"),
+		},
+		{
+			name:       "within budget",
+			ips:        addrs("10.0.0.1", "10.0.0.3"),
+			maxEntries: 2,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.1/32", "10.0.0.3/32"),
+		},
+		{
+			name:       "merge",
+			ips:        addrs("10.0.0.1", "10.0.0.3"),
+			maxEntries: 1,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.0/30"),
+		},
+		{
+			// Merging the cheapest pair first admits 36 addresses
+			name:       "minimal, not greedy",
+			ips:        addrs("10.0.0.4", "10.0.0.8", "10.0.0.39", "10.0.0.46", "10.0.0.56", "10.0.0.59"),
+			maxEntries: 3,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.4/32", "10.0.0.8/32", "10.0.0.32/27"),
+		},
+		{
+			name:       "min-prefix-v4",
+			ips:        addrs("10.0.0.1", "10.0.1.1", "10.0.3.1"),
+			maxEntries: 1,
+			opts:       DefaultLooseOptions,
+			want:       prefixes("10.0.0.1/32", "10.0.1.1/32", "10.0.3.1/32"),
+		},
+		{
+			name:       "min-prefix-v6",
+			ips:        addrs("2001:db8::1", "2001:db8:0:1::1"),
+			maxEntries: 1,
+			opts:       DefaultLooseOptions,
+			want:       prefixes("2001:db8::1/128", "2001:db8:0:1::1/128"),
+		},
+		{
+			name:       "max-overcover-ratio",
+			ips:        addrs("10.0.0.0", "10.0.0.1", "10.0.0.6"),
+			maxEntries: 1,
+			opts:       halfUsed,
+			want:       prefixes("10.0.0.0/31", "10.0.0.6/32"),
+		},
+		{
+			name:       "max-overcover-ratio allows wider merge",
+			ips:        addrs("10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.7"),
+			maxEntries: 1,
+			opts:       halfUsed,
+			want:       prefixes("10.0.0.0/29"),
+		},
+		{
+			name:       "exclude",
+			ips:        addrs("10.0.0.0", "10.0.0.1", "10.0.0.3"),
+			maxEntries: 1,
+			opts:       excluded,
+			want:       prefixes("10.0.0.0/31", "10.0.0.3/32"),
+		},
+		{
+			name:       "IPv4 and IPv6",
+			ips:        addrs("10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2"),
+			maxEntries: 1,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.0/30", "2001:db8::/126"),
+		},
+		{
+			name:       "IPv4 and IPv6 budget",
+			ips:        addrs("10.0.0.1", "10.0.0.2", "10.0.0.200", "2001:db8::1", "2001:db8::2"),
+			maxEntries: 3,
+			opts:       unlimited,
+			want:       prefixes("10.0.0.0/30", "10.0.0.200/32", "2001:db8::/126"),
+		},
+	}
+
+	for _, test := range tests {
+		got := budgetSubnets(test.ips, ipsToSubnetsOptimal(test.ips), test.maxEntries, test.opts)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: budgetSubnets() = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+}
+
+// Compares budgetSubnets with the cheapest of all ways to merge runs of
+// adjacent subnets
+func TestBudgetSubnetsMinimal(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 2000 {
+		opts := DefaultLooseOptions
+		opts.MinPrefixV4 = 20 + r.IntN(8)
+		opts.MaxOvercoverRatio = []float64{1, 0.9, 0.75, 0.5}[r.IntN(4)]
+		ips := []netip.Addr{}
+		for range 2 + r.IntN(8) {
+			ips = append(ips, netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(4)), byte(r.IntN(256))}))
+		}
+		ips = slices.Compact(sortIPs(ips))
+		ipNets := ipsToSubnetsOptimal(ips)
+		maxEntries := 1 + r.IntN(len(ipNets))
+
+		want, fewest := bruteForceBudget(ips, ipNets, maxEntries, opts)
+		got := budgetSubnets(ips, slices.Clone(ipNets), maxEntries, opts)
+
+		if want == -1 {
+			if len(got) != fewest {
+				t.Fatalf("budgetSubnets(%v, %d) = %v, want %d entries", ips, maxEntries, got, fewest)
+			}
+			continue
+		}
+		if len(got) > maxEntries || totalSize(got) != want {
+			t.Fatalf("budgetSubnets(%v, %d) = %v covering %d addresses, want %d", ips, maxEntries, got, totalSize(got), want)
+		}
+		for _, ip := range ips {
+			if !slices.ContainsFunc(got, func(ipNet netip.Prefix) bool { return ipNet.Contains(ip) }) {
+				t.Fatalf("budgetSubnets(%v, %d) = %v does not cover %s", ips, maxEntries, got, ip)
+			}
+		}
+	}
+
+}
+
+// Returns the fewest addresses covered with at most maxEntries subnets, or -1
+// and the fewest entries if maxEntries is not enough
+func bruteForceBudget(ips []netip.Addr, ipNets []netip.Prefix, maxEntries int, opts LooseOptions) (int, int) {
+
+	best, fewest := -1, len(ipNets)
+	// Bit i of cuts set means ipNets[i] and ipNets[i+1] are not merged
+	for cuts := 0; cuts < 1<<(len(ipNets)-1); cuts++ {
+		merged := []netip.Prefix{}
+		first := 0
+		valid := true
+		for i := range ipNets {
+			if i+1 < len(ipNets) && cuts&(1<<i) == 0 {
+				continue
+			}
+			supernet := commonSupernet(ipNets[first], ipNets[i])
+			if first != i {
+				hosts := 0
+				for _, ip := range ips {
+					if supernet.Contains(ip) {
+						hosts++
+					}
+				}
+				// Supernet must not cover subnets of other runs
+				if (first > 0 && supernet.Contains(ipNets[first-1].Addr())) || (i+1 < len(ipNets) && supernet.Contains(ipNets[i+1].Addr())) ||
+					supernet.Bits() < opts.MinPrefixV4 || opts.overcovered(hosts, 32-supernet.Bits()) {
+					valid = false
+					break
+				}
+			}
+			merged = append(merged, supernet)
+			first = i + 1
+		}
+		if !valid {
+			continue
+		}
+		fewest = min(fewest, len(merged))
+		if size := totalSize(merged); len(merged) <= maxEntries && (best == -1 || size < best) {
+			best = size
+		}
+	}
+
+	return best, fewest
+
+}
+
+func totalSize(ipNets []netip.Prefix) int {
+	size := 0
+	for _, ipNet := range ipNets {
+		size += 1 << (32 - ipNet.Bits())
+	}
+	return size
+}
+
+func TestBudgetIPRanges(t *testing.T) {
+
+	halfUsed := DefaultLooseOptions
+	halfUsed.MaxOvercoverRatio = 0.5
+	smallGap := DefaultLooseOptions
+	smallGap.MaxGap = 4
+	excluded := DefaultLooseOptions
+	excluded.Exclude = prefixes("10.0.0.5/32")
+
+	tests := []struct {
+		name       string
+		ips        []netip.Addr
+		maxEntries int
+		opts       LooseOptions
+		want       []string
+	}{
+		{
+			name:       "smallest gap",
+			ips:        addrs("10.0.0.1", "10.0.0.3", "10.0.0.10"),
+			maxEntries: 2,
+			opts:       DefaultLooseOptions,
+			want:       []string{"10.0.0.1 - 10.0.0.3", "10.0.0.10"},
+		},
+		{
+			name:       "all",
+			ips:        addrs("10.0.0.1", "10.0.0.3", "10.0.0.10"),
+			maxEntries: 1,
+			opts:       DefaultLooseOptions,
+			want:       []string{"10.0.0.1 - 10.0.0.10"},
+		},
+		{
+			name:       "max-overcover-ratio",
+			ips:        addrs("10.0.0.1", "10.0.0.3", "10.0.0.10"),
+			maxEntries: 1,
+			opts:       halfUsed,
+			want:       []string{"10.0.0.1 - 10.0.0.3", "10.0.0.10"},
+		},
+		{
+			name:       "max-gap",
+			ips:        addrs("10.0.0.1", "10.0.0.3", "10.0.0.20"),
+			maxEntries: 1,
+			opts:       smallGap,
+			want:       []string{"10.0.0.1 - 10.0.0.3", "10.0.0.20"},
+		},
+		{
+			name:       "min-prefix-v6",
+			ips:        addrs("2001:db8::1", "2001:db8::2", "2001:db8:0:1::1"),
+			maxEntries: 1,
+			opts:       DefaultLooseOptions,
+			want:       []string{"2001:db8::1 - 2001:db8::2", "2001:db8:0:1::1"},
+		},
+		{
+			name:       "exclude",
+			ips:        addrs("10.0.0.1", "10.0.0.3", "10.0.0.10"),
+			maxEntries: 1,
+			opts:       excluded,
+			want:       []string{"10.0.0.1 - 10.0.0.3", "10.0.0.10"},
+		},
+	}
+
+	for _, test := range tests {
+		got := []string{}
+		for _, ipRange := range budgetIPRanges(test.ips, ipsToIPRangesStrict(test.ips), test.maxEntries, test.opts) {
+			got = append(got, ipRange.String())
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: budgetIPRanges() = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+}
+
+// Agents spread over many /8 subnets fit in -max-entries with default flags, as
+// prefix length and gap limits apply only when set explicitly
+func TestBudgetSpreadAgents(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(11, 12))
+	ips := []netip.Addr{}
+	for range 300 {
+		ips = append(ips, netip.AddrFrom4([4]byte{byte(1 + r.IntN(223)), byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256))}))
+	}
+	ips = append(ips, addrs("2001:db8::1", "2400:cb00::1", "2a00:1450::1")...)
+	ips = slices.Compact(sortIPs(ips))
+
+	opts := DefaultLooseOptions.BudgetOptions(nil)
+	for _, maxEntries := range []int{2, 5, 60} {
+		for name, ipNets := range map[string][]netip.Prefix{
+			SubnetListStrict:  ipsToSubnetsStrict(ips),
+			SubnetListOptimal: ipsToSubnetsOptimal(ips),
+			SubnetListLoose:   ipsToSubnetsLoose(ips, DefaultLooseOptions),
+		} {
+			got := budgetSubnets(ips, ipNets, maxEntries, opts)
+			if len(got) > maxEntries {
+				t.Errorf("%s: budgetSubnets(%d) = %d entries", name, maxEntries, len(got))
+			}
+			for _, ip := range ips {
+				if !slices.ContainsFunc(got, func(ipNet netip.Prefix) bool { return ipNet.Contains(ip) }) {
+					t.Fatalf("%s: budgetSubnets(%d) does not cover %s", name, maxEntries, ip)
+				}
+			}
+		}
+		for name, ipRanges := range map[string][]IPRange{
+			IPRangeListStrict: ipsToIPRangesStrict(ips),
+			IPRangeListLoose:  ipsToIPRangesLoose(ips, DefaultLooseOptions),
+		} {
+			got := budgetIPRanges(ips, ipRanges, maxEntries, opts)
+			if len(got) > maxEntries {
+				t.Errorf("%s: budgetIPRanges(%d) = %d entries", name, maxEntries, len(got))
+			}
+			for _, ip := range ips {
+				if !slices.ContainsFunc(got, func(ipRange IPRange) bool { return ipRange.Contains(ip) }) {
+					t.Fatalf("%s: budgetIPRanges(%d) does not cover %s", name, maxEntries, ip)
+				}
+			}
+		}
+	}
+
+	// Explicit limits still apply
+	explicit := DefaultLooseOptions.BudgetOptions(map[string]bool{"min-prefix-v4": true, "max-gap": true})
+	if got := budgetSubnets(ips, ipsToSubnetsStrict(ips), 5, explicit); len(got) <= 5 {
+		t.Errorf("budgetSubnets() with explicit -min-prefix-v4 = %d entries, want more than 5", len(got))
+	}
+	if got := budgetIPRanges(ips, ipsToIPRangesStrict(ips), 5, explicit); len(got) <= 5 {
+		t.Errorf("budgetIPRanges() with explicit -max-gap = %d entries, want more than 5", len(got))
+	}
+
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores API responses on disk, so repeated invocations within TTL do
+// not issue API calls. Expired responses are revalidated with ETag, when the
+// API provides one.
+type Cache struct {
+	Dir     string
+	TTL     time.Duration
+	Refresh bool
+}
+
+type CacheEntry struct {
+	Endpoint string    `json:"endpoint"`
+	ETag     string    `json:"etag,omitempty"`
+	Fetched  time.Time `json:"fetched"`
+	Body     []byte    `json:"body"`
+}
+
+func (cache *Cache) Request(token, endpoint string) (*http.Response, error) {
+
+	entry, found := cache.get(token, endpoint)
+	if found && !cache.Refresh && time.Since(entry.Fetched) < cache.TTL {
+		return entry.response(), nil
+	}
+
+	etag := ""
+	if found {
+		etag = entry.ETag
+	}
+
+	response, err := apiHTTPRequest(token, endpoint, etag)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		entry.Fetched = time.Now()
+		cache.put(token, entry)
+		return entry.response(), nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("TE API request error: %s", err.Error())
+	}
+
+	entry = CacheEntry{Endpoint: endpoint, ETag: response.Header.Get("ETag"), Fetched: time.Now(), Body: body}
+	cache.put(token, entry)
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return response, nil
+
+}
+
+// Cache entries are keyed by API URL, token and endpoint, which includes the
+// Account Group ID, so responses are never shared between APIs, users or
+// Account Groups
+func (cache *Cache) path(token, endpoint string) string {
+	sum := sha256.Sum256([]byte(apiURL + "\n" + token + "\n" + endpoint))
+	return filepath.Join(cache.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (cache *Cache) get(token, endpoint string) (CacheEntry, bool) {
+
+	var entry CacheEntry
+
+	b, err := os.ReadFile(cache.path(token, endpoint))
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Endpoint != endpoint {
+		return CacheEntry{}, false
+	}
+
+	return entry, true
+
+}
+
+// Failing to write the cache is not fatal, response is simply not cached
+func (cache *Cache) put(token string, entry CacheEntry) {
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(cache.Dir, 0700); err != nil {
+		return
+	}
+
+	path := cache.path(token, entry.Endpoint)
+	tmp, err := os.CreateTemp(cache.Dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+
+}
+
+func (entry CacheEntry) response() *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(entry.Body)),
+	}
+}
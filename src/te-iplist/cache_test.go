@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Serves a versioned body with an ETag, which changes when version is bumped,
+// and counts requests and revalidations
+func mockCacheAPI(t *testing.T, version *atomic.Int32) (requests, revalidations *atomic.Int32) {
+	requests, revalidations = new(atomic.Int32), new(atomic.Int32)
+	mockAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		if r.Header.Get("If-None-Match") != "" {
+			revalidations.Add(1)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, "body v%d", version.Load())
+	})
+	return requests, revalidations
+}
+
+func cacheRequest(t *testing.T, cache *Cache) string {
+	t.Helper()
+	response, err := cache.Request("token", "/agents")
+	if err != nil {
+		t.Fatalf("Request() error: %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("Request() body error: %v", err)
+	}
+	return string(body)
+}
+
+// Moves the cached entry's fetch time into the past, so it looks expired
+func expireCacheEntry(t *testing.T, cache *Cache, age time.Duration) {
+	t.Helper()
+	entry, found := cache.get("token", "/agents")
+	if !found {
+		t.Fatal("get() found no cache entry")
+	}
+	entry.Fetched = time.Now().Add(-age)
+	cache.put("token", entry)
+}
+
+func TestCacheTTL(t *testing.T) {
+
+	version := new(atomic.Int32)
+	requests, revalidations := mockCacheAPI(t, version)
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+
+	// First request is fetched, second within TTL is served from cache
+	if body := cacheRequest(t, cache); body != "body v0" {
+		t.Errorf("Request() = %q, want %q", body, "body v0")
+	}
+	version.Store(1)
+	if body := cacheRequest(t, cache); body != "body v0" {
+		t.Errorf("Request() within TTL = %q, want cached %q", body, "body v0")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("API requests within TTL = %d, want 1", requests.Load())
+	}
+
+	// Expired entry is revalidated with its ETag and replaced, as it changed
+	expireCacheEntry(t, cache, 2*time.Hour)
+	if body := cacheRequest(t, cache); body != "body v1" {
+		t.Errorf("Request() after TTL = %q, want %q", body, "body v1")
+	}
+	if requests.Load() != 2 || revalidations.Load() != 1 {
+		t.Errorf("API requests after TTL = %d (%d revalidations), want 2 (1)", requests.Load(), revalidations.Load())
+	}
+
+	// Expired entry which has not changed is kept, and its TTL restarts
+	expireCacheEntry(t, cache, 2*time.Hour)
+	if body := cacheRequest(t, cache); body != "body v1" {
+		t.Errorf("Request() not modified = %q, want %q", body, "body v1")
+	}
+	if body := cacheRequest(t, cache); body != "body v1" {
+		t.Errorf("Request() after revalidation = %q, want %q", body, "body v1")
+	}
+	if requests.Load() != 3 || revalidations.Load() != 2 {
+		t.Errorf("API requests after revalidation = %d (%d revalidations), want 3 (2)", requests.Load(), revalidations.Load())
+	}
+
+}
+
+func TestCacheRefresh(t *testing.T) {
+
+	version := new(atomic.Int32)
+	requests, _ := mockCacheAPI(t, version)
+	dir := t.TempDir()
+
+	cacheRequest(t, &Cache{Dir: dir, TTL: time.Hour})
+	version.Store(1)
+
+	// -refresh ignores an unexpired entry, and updates it for later requests
+	if body := cacheRequest(t, &Cache{Dir: dir, TTL: time.Hour, Refresh: true}); body != "body v1" {
+		t.Errorf("Request() with refresh = %q, want %q", body, "body v1")
+	}
+	if body := cacheRequest(t, &Cache{Dir: dir, TTL: time.Hour}); body != "body v1" {
+		t.Errorf("Request() after refresh = %q, want %q", body, "body v1")
+	}
+	if requests.Load() != 2 {
+		t.Errorf("API requests = %d, want 2", requests.Load())
+	}
+
+}
+
+// Entries are not shared between tokens
+func TestCacheToken(t *testing.T) {
+
+	version := new(atomic.Int32)
+	requests, _ := mockCacheAPI(t, version)
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+
+	for _, token := range []string{"token", "other", "token"} {
+		response, err := cache.Request(token, "/agents")
+		if err != nil {
+			t.Fatalf("Request() error: %v", err)
+		}
+		response.Body.Close()
+	}
+	if requests.Load() != 2 {
+		t.Errorf("API requests = %d, want 2", requests.Load())
+	}
+
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile holds flag values, keyed by flag name, loaded from configuration file
+type Profile map[string]ProfileValue
+
+// Value of a profile option, Array is true if it was written as an array
+type ProfileValue struct {
+	Values []string
+	Array  bool
+}
+
+// Path of the default configuration file, ~/.config/te-iplist/config.toml
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "te-iplist", "config.toml")
+}
+
+// Sets flags from the named profile. Flags provided on the command line take
+// precedence over profile values.
+func applyProfile(configPath, name string) error {
+
+	profiles, err := loadProfiles(configPath)
+	if err != nil {
+		return err
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		names := []string{}
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile not found in %s (available profiles: %s)", configPath, strings.Join(names, ", "))
+	}
+
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	for key, value := range profile {
+		if key == "profile" || key == "config" {
+			return fmt.Errorf("'%s' can not be set in a profile", key)
+		}
+		if flag.Lookup(key) == nil {
+			return fmt.Errorf("unknown option '%s'", key)
+		}
+		if setFlags[key] {
+			continue
+		}
+		if f, ok := flag.Lookup(key).Value.(repeatableFlag); ok && f.Repeatable() {
+			for _, v := range value.Values {
+				if err := flag.Set(key, v); err != nil {
+					return fmt.Errorf("invalid value for '%s': %s", key, err.Error())
+				}
+			}
+			continue
+		}
+		// Other flags take comma separated lists, so array items are joined with
+		// commas, and items containing one would be split
+		if value.Array && slices.ContainsFunc(value.Values, func(v string) bool { return strings.Contains(v, ",") }) {
+			return fmt.Errorf("array items of '%s' can not contain ','", key)
+		}
+		err := flag.Set(key, strings.Join(value.Values, ","))
+		if err != nil {
+			return fmt.Errorf("invalid value for '%s': %s", key, err.Error())
+		}
+	}
+
+	return nil
+
+}
+
+// Loads profiles from a TOML configuration file. Only the subset of TOML that
+// is needed to describe flags is supported:
+//
+//	[profiles.prod-edge]
+//	token-file = "~/.te-token"
+//	aid = "1234"
+//	e-public = true
+//	country = ["US", "SI", "DE"]
+//	o = "subnet-loose"
+//	out = "/etc/nginx/te-agents.conf"
+func loadProfiles(configPath string) (map[string]Profile, error) {
+
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	profiles := map[string]Profile{}
+	var profile Profile
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if !strings.HasPrefix(section, "profiles.") {
+				return nil, fmt.Errorf("%s:%d: unsupported section [%s]", configPath, lineNo, section)
+			}
+			name := strings.Trim(strings.TrimPrefix(section, "profiles."), "\"'")
+			profile = Profile{}
+			profiles[name] = profile
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key = value", configPath, lineNo)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("%s:%d: option outside of a [profiles.<name>] section", configPath, lineNo)
+		}
+		profileValue, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", configPath, lineNo, err.Error())
+		}
+		profile[strings.Trim(strings.TrimSpace(key), "\"'")] = profileValue
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+
+}
+
+// Parses a quoted string, bare word (boolean, number) or an array of those
+func parseConfigValue(value string) (ProfileValue, error) {
+
+	if !strings.HasPrefix(value, "[") {
+		v, rest, err := parseConfigScalar(value, false)
+		if err != nil {
+			return ProfileValue{}, err
+		}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			return ProfileValue{}, fmt.Errorf("unexpected '%s' after value", rest)
+		}
+		return ProfileValue{Values: []string{v}}, nil
+	}
+
+	// Items are split on commas outside of quoted strings, so quoted items may
+	// contain commas
+	values := []string{}
+	rest := strings.TrimSpace(value[1:])
+	for {
+		if rest == "" {
+			return ProfileValue{}, errors.New("unterminated array")
+		}
+		if rest[0] == ']' {
+			if rest = strings.TrimSpace(rest[1:]); rest != "" {
+				return ProfileValue{}, fmt.Errorf("unexpected '%s' after array", rest)
+			}
+			return ProfileValue{Values: values, Array: true}, nil
+		}
+		v, r, err := parseConfigScalar(rest, true)
+		if err != nil {
+			return ProfileValue{}, err
+		}
+		values = append(values, v)
+		rest = strings.TrimSpace(r)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return ProfileValue{}, errors.New("expected ',' or ']' in array")
+		}
+	}
+
+}
+
+// Parses a quoted string or bare word at the start of value and returns the
+// rest of value. Double quoted strings support escapes, i.e. "a\\.b" is a\.b,
+// single quoted strings are literal. Bare words in arrays end at , or ].
+func parseConfigScalar(value string, inArray bool) (string, string, error) {
+
+	if value == "" {
+		return "", "", errors.New("missing value")
+	}
+
+	var s, rest string
+	switch value[0] {
+	case '"':
+		end := 1
+		for ; end < len(value) && value[end] != '"'; end++ {
+			if value[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(value) {
+			return "", "", errors.New("unterminated string")
+		}
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", value[:end+1])
+		}
+		s, rest = unquoted, value[end+1:]
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end == -1 {
+			return "", "", errors.New("unterminated string")
+		}
+		s, rest = value[1:end+1], value[end+2:]
+	default:
+		end := len(value)
+		if inArray {
+			if i := strings.IndexAny(value, ",]"); i != -1 {
+				end = i
+			}
+		}
+		s, rest = strings.TrimSpace(value[:end]), value[end:]
+		if s == "" {
+			return "", "", errors.New("missing value")
+		}
+	}
+
+	if strings.HasPrefix(s, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			s = filepath.Join(home, s[2:])
+		}
+	}
+
+	return s, rest, nil
+
+}
+
+// Removes a # comment that is not part of a quoted string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '#' {
+			return line[:i]
+		}
+	}
+	return line
+}
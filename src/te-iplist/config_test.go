@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+
+	tests := []struct {
+		value string
+		want  []string
+		array bool
+		err   bool
+	}{
+		{value: `"subnet-loose"`, want: []string{"subnet-loose"}},
+		{value: `true`, want: []string{"true"}},
+		{value: `1234`, want: []string{"1234"}},
+		{value: `"123,456"`, want: []string{"123,456"}},
+		{value: `""`, want: []string{""}},
+		{value: `["US", "SI", "DE"]`, want: []string{"US", "SI", "DE"}, array: true},
+		{value: `["a,b", "c"]`, want: []string{"a,b", "c"}, array: true},
+		{value: `['a,b', 'c]']`, want: []string{"a,b", "c]"}, array: true},
+		{value: `[1, 2,3]`, want: []string{"1", "2", "3"}, array: true},
+		{value: `[]`, want: []string{}, array: true},
+		{value: `["US",]`, want: []string{"US"}, array: true},
+		{value: `"a\\.b"`, want: []string{`a\.b`}},
+		{value: `'a\.b'`, want: []string{`a\.b`}},
+		{value: `"say \"hi\", then"`, want: []string{`say "hi", then`}},
+		{value: `["\"", ","]`, want: []string{`"`, ","}, array: true},
+		{value: ``, err: true},
+		{value: `"unterminated`, err: true},
+		{value: `["US", "SI"`, err: true},
+		{value: `["US" "SI"]`, err: true},
+		{value: `"US" "SI"`, err: true},
+		{value: `["US"] x`, err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseConfigValue(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseConfigValue(%s) = %q, want error", test.value, got.Values)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseConfigValue(%s) error: %s", test.value, err)
+			continue
+		}
+		if !slices.Equal(got.Values, test.want) || got.Array != test.array {
+			t.Errorf("parseConfigValue(%s) = %q (array %t), want %q (array %t)", test.value, got.Values, got.Array, test.want, test.array)
+		}
+	}
+
+}
+
+func TestStripComment(t *testing.T) {
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: `o = "ip" # comment`, want: `o = "ip" `},
+		{line: `location-regex = ["#1"] # comment`, want: `location-regex = ["#1"] `},
+		{line: `location-regex = ["\"#"]`, want: `location-regex = ["\"#"]`},
+		{line: `location-regex = ['\' # comment`, want: `location-regex = ['\' `},
+	}
+
+	for _, test := range tests {
+		if got := stripComment(test.line); got != test.want {
+			t.Errorf("stripComment(%s) = %s, want %s", test.line, got, test.want)
+		}
+	}
+
+}
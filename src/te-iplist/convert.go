@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Reads lists of any list output type from files, or standard input if no file
+// or "-" is provided, so they can be re-aggregated to any output type without
+// API calls. Entries are assigned to synthetic Agents named by the -n comment,
+// or by the file name for entries without comment.
+func convertAgents(paths []string, ipv4, ipv6 bool) ([]Agent, error) {
+
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	names := []string{}
+	agentNets := map[string][]netip.Prefix{}
+	allNets := []netip.Prefix{}
+	for _, path := range paths {
+		fileNets, err := readConvertFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileNet := range fileNets {
+			if _, ok := agentNets[fileNet.Name]; !ok {
+				names = append(names, fileNet.Name)
+			}
+			agentNets[fileNet.Name] = append(agentNets[fileNet.Name], fileNet.IPNets...)
+			allNets = append(allNets, fileNet.IPNets...)
+		}
+	}
+	if !subnetsFit(allNets) {
+		return nil, fmt.Errorf("converted lists expand to more than %d addresses", MaxSubnetAddresses)
+	}
+
+	agents := []Agent{}
+	for _, name := range names {
+		agent := subnetsAgent(name, agentNets[name], ipv4, ipv6)
+		if len(agent.IPv4Addresses) > 0 || len(agent.IPv6Addresses) > 0 {
+			agents = append(agents, agent)
+		}
+	}
+
+	return agents, nil
+
+}
+
+// Subnets of a list entry and the Agent name they belong to
+type convertNets struct {
+	Name   string
+	IPNets []netip.Prefix
+}
+
+func readConvertFile(path string) ([]convertNets, error) {
+
+	var r io.Reader
+	name := path
+	if path == "-" {
+		r = os.Stdin
+		name = "stdin"
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	lines, err := readListLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	fileNets := []convertNets{}
+	for _, line := range lines {
+		lineIPNets, err := parseIPNets(strings.Split(line.Entry, ","))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line.Number, err.Error())
+		}
+		if line.Comment == "" {
+			fileNets = append(fileNets, convertNets{name, lineIPNets})
+			continue
+		}
+		// -n comments list names of all Agents covered by the entry
+		for _, agentName := range strings.Split(line.Comment, ListSeparatorChar) {
+			if agentName = strings.TrimSpace(agentName); agentName != "" {
+				fileNets = append(fileNets, convertNets{agentName, lineIPNets})
+			}
+		}
+	}
+
+	return fileNets, nil
+
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"slices"
+	"strconv"
+)
+
+// Coverage of a single subnet, range or block
+type Coverage struct {
+	Entry     string
+	AgentIPs  int
+	Addresses *big.Int
+}
+
+// ips []netip.Addr MUST be sorted, as returned by AgentIndex.IPs()
+func subnetsCoverage(ips []netip.Addr, ipNets []netip.Prefix) []Coverage {
+
+	coverage := []Coverage{}
+	for _, ipNet := range ipNets {
+		c := Coverage{Entry: ipNet.String(), Addresses: subnetSize(ipNet)}
+		if ipNet.IsSingleIP() {
+			c.Entry = ipNet.Addr().String()
+		}
+		c.AgentIPs = countIPsBetween(ips, ipNet.Masked().Addr(), lastAddr(ipNet))
+		coverage = append(coverage, c)
+	}
+
+	return coverage
+
+}
+
+// ips []netip.Addr MUST be sorted, as returned by AgentIndex.IPs()
+func ipRangesCoverage(ips []netip.Addr, ipRanges []IPRange) []Coverage {
+
+	coverage := []Coverage{}
+	for _, ipRange := range ipRanges {
+		c := Coverage{Entry: ipRange.String(), Addresses: ipRangeSize(ipRange)}
+		c.AgentIPs = countIPsBetween(ips, ipRange.StartIP, ipRange.EndIP)
+		coverage = append(coverage, c)
+	}
+
+	return coverage
+
+}
+
+// ips []netip.Addr MUST be sorted, as returned by AgentIndex.IPs()
+func ipBlocksCoverage(ips []netip.Addr, ipBlocks []IPBlock) []Coverage {
+
+	coverage := []Coverage{}
+	for _, ipBlock := range ipBlocks {
+		c := Coverage{Entry: ipBlock.String(), Addresses: ipBlockSize(ipBlock)}
+		if blockIPs, ok := ipBlock.cRangeIPs(); ok {
+			for _, ip := range blockIPs {
+				c.AgentIPs += countIPsBetween(ips, ip, ip)
+			}
+		} else {
+			c.AgentIPs = countIPsBetween(ips, ipBlock.StartIP, ipBlock.EndIP)
+		}
+		coverage = append(coverage, c)
+	}
+
+	return coverage
+
+}
+
+// Number of sorted IPs between start and end IP of the same version
+func countIPsBetween(ips []netip.Addr, start, end netip.Addr) int {
+	first, _ := slices.BinarySearchFunc(ips, start, netip.Addr.Compare)
+	last, found := slices.BinarySearchFunc(ips, end, netip.Addr.Compare)
+	if found {
+		last++
+	}
+	return max(last-first, 0)
+}
+
+// Number of addresses in IP block
+func ipBlockSize(ipBlock IPBlock) *big.Int {
+	if ips, ok := ipBlock.cRangeIPs(); ok {
+		return big.NewInt(int64(len(ips)))
+	}
+	return ipRangeSize(IPRange{ipBlock.StartIP, ipBlock.EndIP})
+}
+
+// Prints number of Agent IPs, addresses and percentage of addresses not used by
+// Agents for each entry, followed by totals
+func outputCoverageReport(w io.Writer, coverage []Coverage) {
+
+	totalAgentIPs := 0
+	totalAddresses := new(big.Int)
+	maxEntryLen := 5
+	for _, c := range coverage {
+		totalAgentIPs += c.AgentIPs
+		totalAddresses.Add(totalAddresses, c.Addresses)
+		if len(c.Entry) > maxEntryLen {
+			maxEntryLen = len(c.Entry)
+		}
+	}
+	maxAddressesLen := len(totalAddresses.String())
+	if maxAddressesLen < 9 {
+		maxAddressesLen = 9
+	}
+
+	fmt.Fprintf(w, "%s  %s  %s  %s\n", pad("Entry", maxEntryLen), pad("Agent IPs", 9), pad("Addresses", maxAddressesLen), "Over-coverage")
+	for _, c := range coverage {
+		fmt.Fprintf(w, "%s  %s  %s  %s\n", pad(c.Entry, maxEntryLen), pad(strconv.Itoa(c.AgentIPs), 9), pad(c.Addresses.String(), maxAddressesLen), overcoverage(c.AgentIPs, c.Addresses))
+	}
+	fmt.Fprintf(w, "%s  %s  %s  %s\n", pad("Total", maxEntryLen), pad(strconv.Itoa(totalAgentIPs), 9), pad(totalAddresses.String(), maxAddressesLen), overcoverage(totalAgentIPs, totalAddresses))
+
+}
+
+// Percentage of addresses not used by Agents
+func overcoverage(agentIPs int, addresses *big.Int) string {
+	if addresses.Sign() == 0 {
+		return "0.00%"
+	}
+	extra := new(big.Float).SetInt(new(big.Int).Sub(addresses, big.NewInt(int64(agentIPs))))
+	ratio, _ := extra.Quo(extra, new(big.Float).SetInt(addresses)).Float64()
+	return strconv.FormatFloat(ratio*100, 'f', 2, 64) + "%"
+}
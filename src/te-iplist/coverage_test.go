@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestReportCoverage(t *testing.T) {
+
+	agents := []Agent{{AgentName: "a", IPv4Addresses: addrs("10.0.0.1", "10.0.0.2", "10.0.1.2", "10.0.2.2")}}
+
+	tests := []struct {
+		output string
+		report []string
+	}{
+		{output: SubnetListLoose, report: []string{"10.0.0.0/30", "2", "4", "50.00%"}},
+		{output: IPRangeListStrict, report: []string{"10.0.0.1 - 10.0.0.2", "2", "2", "0.00%"}},
+		{output: IPBlockListStrict, report: []string{"10.0.0.[1-2]", "2", "2", "0.00%"}},
+	}
+
+	for _, test := range tests {
+		var list, listWithReport, report bytes.Buffer
+		outputAgents(&list, agents, test.output, ListOptions{Loose: DefaultLooseOptions})
+		outputAgents(&listWithReport, agents, test.output, ListOptions{Loose: DefaultLooseOptions, Coverage: &report})
+
+		if list.String() != listWithReport.String() {
+			t.Errorf("%s: list with -report-coverage = %q, want %q", test.output, listWithReport.String(), list.String())
+		}
+		lines := strings.Split(report.String(), "\n")
+		if len(lines) < 3 || !strings.HasPrefix(lines[0], "Entry") || !strings.HasPrefix(lines[len(lines)-2], "Total") {
+			t.Errorf("%s: report = %q, want header, entries and totals", test.output, report.String())
+			continue
+		}
+		if fields := strings.Fields(strings.ReplaceAll(lines[1], " - ", "-")); strings.Join(fields, " ") != strings.ReplaceAll(strings.Join(test.report, " "), " - ", "-") {
+			t.Errorf("%s: first report entry = %q, want %q", test.output, lines[1], strings.Join(test.report, "  "))
+		}
+	}
+
+}
+
+func TestIPBlocksCoverage(t *testing.T) {
+
+	ips := addrs("10.0.0.1", "10.0.0.2", "10.0.1.20", "10.0.1.21", "10.0.3.20", "2001:db8::1", "2001:db8::3", "2001:db8::1:0")
+	ipBlocks := []IPBlock{
+		{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.4")},
+		// Only addresses with D part 20 are in the block
+		{netip.MustParseAddr("10.0.1.20"), netip.MustParseAddr("10.0.4.20")},
+		{netip.MustParseAddr("2001:db8::"), netip.MustParseAddr("2001:db8::ff")},
+		{netip.MustParseAddr("2001:db8::1:0"), netip.MustParseAddr("2001:db8::1:0")},
+	}
+	want := []struct {
+		entry     string
+		agentIPs  int
+		addresses int64
+	}{
+		{"10.0.0.[1-4]", 2, 4},
+		{"10.0.[1-4].20", 2, 4},
+		{"2001:db8::[0-ff]", 2, 256},
+		{"2001:db8::1:0", 1, 1},
+	}
+
+	coverage := ipBlocksCoverage(ips, ipBlocks)
+	for i, c := range coverage {
+		if c.Entry != want[i].entry || c.AgentIPs != want[i].agentIPs || c.Addresses.Int64() != want[i].addresses {
+			t.Errorf("ipBlocksCoverage()[%d] = %s %d %s, want %s %d %d", i, c.Entry, c.AgentIPs, c.Addresses, want[i].entry, want[i].agentIPs, want[i].addresses)
+		}
+	}
+
+}
+
+// Counts match a scan of all Agent IPs for every entry
+func TestCoverageCounts(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(13, 14))
+	for range 200 {
+		ips := newAgentIndex(randomAgents(r, 1+r.IntN(20), 4)).IPs()
+		count := func(contains func(netip.Addr) bool) int {
+			n := 0
+			for _, ip := range ips {
+				if contains(ip) {
+					n++
+				}
+			}
+			return n
+		}
+		opts := DefaultLooseOptions
+		opts.MinPrefixV4 = 20 + r.IntN(8)
+
+		ipNets := ipsToSubnetsLoose(ips, opts)
+		for i, c := range subnetsCoverage(ips, ipNets) {
+			if want := count(ipNets[i].Contains); c.AgentIPs != want {
+				t.Fatalf("subnetsCoverage(%s) = %d Agent IPs, want %d", ipNets[i], c.AgentIPs, want)
+			}
+		}
+		ipRanges := ipsToIPRangesLoose(ips, opts)
+		for i, c := range ipRangesCoverage(ips, ipRanges) {
+			if want := count(ipRanges[i].Contains); c.AgentIPs != want {
+				t.Fatalf("ipRangesCoverage(%s) = %d Agent IPs, want %d", ipRanges[i], c.AgentIPs, want)
+			}
+		}
+		ipBlocks := ipsToIPBlocksLoose(ips, opts)
+		for i, c := range ipBlocksCoverage(ips, ipBlocks) {
+			if want := count(ipBlocks[i].Contains); c.AgentIPs != want {
+				t.Fatalf("ipBlocksCoverage(%s) = %d Agent IPs, want %d", ipBlocks[i], c.AgentIPs, want)
+			}
+		}
+	}
+
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/netip"
+)
+
+// Removes Agent IPs inside excluded subnets. Agents left without IPs are
+// removed.
+func excludeAgentIPs(agents []Agent, exclude []netip.Prefix) []Agent {
+
+	if len(exclude) == 0 {
+		return agents
+	}
+
+	returnAgents := []Agent{}
+	for _, agent := range agents {
+		hadIPs := len(agent.IPv4Addresses) > 0 || len(agent.IPv6Addresses) > 0
+		agent.IPv4Addresses = excludeIPs(agent.IPv4Addresses, exclude)
+		agent.IPv6Addresses = excludeIPs(agent.IPv6Addresses, exclude)
+		if hadIPs && len(agent.IPv4Addresses) == 0 && len(agent.IPv6Addresses) == 0 {
+			continue
+		}
+		returnAgents = append(returnAgents, agent)
+	}
+
+	return returnAgents
+
+}
+
+func excludeIPs(ips []netip.Addr, exclude []netip.Prefix) []netip.Addr {
+
+	returnIPs := []netip.Addr{}
+	for _, ip := range ips {
+		if !excludedIP(ip, exclude) {
+			returnIPs = append(returnIPs, ip)
+		}
+	}
+
+	return returnIPs
+
+}
+
+func excludedIP(ip netip.Addr, exclude []netip.Prefix) bool {
+	for _, ipNet := range exclude {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any address between start and end IP is excluded. IPv4
+// addresses sort before IPv6, so subnets of the other version never match.
+func excludedRange(start, end netip.Addr, exclude []netip.Prefix) bool {
+	for _, ipNet := range exclude {
+		if ipNet.Addr().Compare(end) <= 0 && start.Compare(lastAddr(ipNet)) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any address in the subnet is excluded
+func excludedSubnet(ipNet netip.Prefix, exclude []netip.Prefix) bool {
+	return excludedRange(ipNet.Addr(), lastAddr(ipNet), exclude)
+}
+
+// Returns true if any address in the block is excluded
+func excludedBlock(ipBlock IPBlock, exclude []netip.Prefix) bool {
+	if ips, ok := ipBlock.cRangeIPs(); ok {
+		for _, ip := range ips {
+			if excludedIP(ip, exclude) {
+				return true
+			}
+		}
+		return false
+	}
+	return excludedRange(ipBlock.StartIP, ipBlock.EndIP, exclude)
+}
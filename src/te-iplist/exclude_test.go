@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestExcludeAgentIPs(t *testing.T) {
+
+	agents := []Agent{
+		{AgentName: "a", IPv4Addresses: addrs("10.0.0.1", "192.0.2.1"), IPv6Addresses: addrs("2001:db8::1")},
+		{AgentName: "b", IPv4Addresses: addrs("10.0.0.2")},
+		{AgentName: "c"},
+	}
+	got := excludeAgentIPs(agents, prefixes("10.0.0.0/8", "2001:db8::1/128"))
+
+	// Agents left without IPs are removed, Agents without IPs are kept
+	if names := agentNames(got); !slices.Equal(names, []string{"a", "c"}) {
+		t.Fatalf("excludeAgentIPs() = %v, want [a c]", names)
+	}
+	if !slices.Equal(got[0].IPv4Addresses, addrs("192.0.2.1")) || len(got[0].IPv6Addresses) != 0 {
+		t.Errorf("excludeAgentIPs() a = %v %v, want [192.0.2.1] []", got[0].IPv4Addresses, got[0].IPv6Addresses)
+	}
+
+}
+
+// Loose output types and -max-entries never cover excluded addresses
+func TestExcludeNeverCovered(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(15, 16))
+	for range 300 {
+		exclude := []netip.Prefix{}
+		for range 1 + r.IntN(3) {
+			ip := netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(4)), byte(r.IntN(256))})
+			ipNet, _ := ip.Prefix(28 + r.IntN(5))
+			exclude = append(exclude, ipNet)
+		}
+		agents := excludeAgentIPs(randomAgents(r, 2+r.IntN(20), 4), exclude)
+		ips := newAgentIndex(agents).IPs()
+		if len(ips) == 0 {
+			continue
+		}
+		opts := DefaultLooseOptions
+		opts.MinPrefixV4 = 16 + r.IntN(8)
+		opts.Exclude = exclude
+		budget := opts.BudgetOptions(nil)
+		maxEntries := 1 + r.IntN(4)
+
+		covers := func(name string, entry ListEntry) {
+			for _, ipNet := range exclude {
+				for ip := ipNet.Addr(); ipNet.Contains(ip); ip = ip.Next() {
+					if entry.Contains(ip) {
+						t.Fatalf("%s entry %s covers excluded %s", name, entry, ip)
+					}
+				}
+			}
+		}
+		for _, ip := range ips {
+			if excludedIP(ip, exclude) {
+				t.Fatalf("excluded Agent IP %s was not removed", ip)
+			}
+		}
+		for _, ipNet := range ipsToSubnetsLoose(ips, opts) {
+			covers(SubnetListLoose, ipNet)
+		}
+		for _, ipRange := range ipsToIPRangesLoose(ips, opts) {
+			covers(IPRangeListLoose, ipRange)
+		}
+		for _, ipBlock := range ipsToIPBlocksLoose(ips, opts) {
+			covers(IPBlockListLoose, ipBlock)
+		}
+		for _, ipNet := range budgetSubnets(ips, ipsToSubnetsOptimal(ips), maxEntries, budget) {
+			covers(SubnetListOptimal+" -max-entries", ipNet)
+		}
+		for _, ipNet := range budgetSubnets(ips, ipsToSubnetsLoose(ips, opts), maxEntries, budget) {
+			covers(SubnetListLoose+" -max-entries", ipNet)
+		}
+		for _, ipRange := range budgetIPRanges(ips, ipsToIPRangesStrict(ips), maxEntries, budget) {
+			covers(IPRangeListStrict+" -max-entries", ipRange)
+		}
+		for _, ipRange := range budgetIPRanges(ips, ipsToIPRangesLoose(ips, opts), maxEntries, budget) {
+			covers(IPRangeListLoose+" -max-entries", ipRange)
+		}
+	}
+
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AgentFilter selects Agents by ID, name and location. Agents must match all
+// filters that are set.
+type AgentFilter struct {
+	AgentIDs        []int
+	ExcludeAgentIDs []int
+	NameRegexps     []*regexp.Regexp
+	LocationRegexps []*regexp.Regexp
+	// IDs of Agents assigned to tests selected by -test-id and -test-name-regex,
+	// nil if tests are not filtered
+	TestAgentIDs map[int]bool
+	// Agents that do not report state or enabled flag, i.e. Cloud Agents, are
+	// considered online and enabled
+	OnlineOnly  bool
+	EnabledOnly bool
+	// Names of labels Agents must have, matched case-insensitively
+	Labels []string
+	// Regions and continent codes of Agent countries, matched case-insensitively
+	Regions    []string
+	Continents []string
+	// Country codes, matched case-insensitively
+	Countries        []string
+	ExcludeCountries []string
+}
+
+func (filter AgentFilter) Match(agent Agent) bool {
+	if len(filter.AgentIDs) > 0 && !slices.Contains(filter.AgentIDs, agent.AgentID) {
+		return false
+	}
+	if slices.Contains(filter.ExcludeAgentIDs, agent.AgentID) {
+		return false
+	}
+	if filter.TestAgentIDs != nil && !filter.TestAgentIDs[agent.AgentID] {
+		return false
+	}
+	if filter.OnlineOnly && !agent.Online() {
+		return false
+	}
+	if filter.EnabledOnly && agent.Enabled != nil && !*agent.Enabled {
+		return false
+	}
+	for _, label := range filter.Labels {
+		if !containsFold(agent.LabelNames(), label) {
+			return false
+		}
+	}
+	if len(filter.Countries) > 0 && !containsFold(filter.Countries, agent.CountryID) {
+		return false
+	}
+	if containsFold(filter.ExcludeCountries, agent.CountryID) {
+		return false
+	}
+	if len(filter.Regions) > 0 && !containsFold(filter.Regions, countryRegion(agent.CountryID)) {
+		return false
+	}
+	if len(filter.Continents) > 0 && !containsFold(filter.Continents, countryContinent(agent.CountryID)) {
+		return false
+	}
+	for _, re := range filter.NameRegexps {
+		if !re.MatchString(agent.AgentName) {
+			return false
+		}
+	}
+	for _, re := range filter.LocationRegexps {
+		if !re.MatchString(agent.Location) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(item string) bool { return strings.EqualFold(item, s) })
+}
+
+// Splits a comma separated list, an empty string is an empty list
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Removes repeated items of the list, keeping the first
+func uniqueList(list []string) []string {
+	unique := []string{}
+	for _, item := range list {
+		if !slices.Contains(unique, item) {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// Prefixes every item of the list
+func prefixList(list []string, prefix string) []string {
+	prefixed := []string{}
+	for _, item := range list {
+		prefixed = append(prefixed, prefix+item)
+	}
+	return prefixed
+}
+
+// Splits country codes into included and excluded, prefixed with !. Codes that
+// are not ISO 3166-1 alpha-2 country codes are logged, as they match no Agent.
+func parseCountries(list []string) ([]string, []string) {
+
+	countries, excludeCountries := []string{}, []string{}
+	for _, country := range list {
+		exclude := strings.HasPrefix(country, "!")
+		country = strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(country, "!")))
+		if !validCountry(country) {
+			log.Warn("'%s' is not an ISO 3166-1 alpha-2 country code, no Agent is in this country", country)
+		}
+		if exclude {
+			excludeCountries = append(excludeCountries, country)
+		} else {
+			countries = append(countries, country)
+		}
+	}
+
+	return countries, excludeCountries
+
+}
+
+type Label struct {
+	LabelID string `json:"labelId"`
+	Name    string `json:"name"`
+}
+
+// Returns true if the Agent is online or does not report its state
+func (agent Agent) Online() bool {
+	return agent.AgentState == "" || strings.EqualFold(agent.AgentState, AgentStateOnline)
+}
+
+func (agent Agent) LabelNames() []string {
+	names := []string{}
+	for _, label := range agent.Labels {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+// Flag values that are set once for every value of a profile list, instead of
+// once with comma separated values
+type repeatableFlag interface {
+	Repeatable() bool
+}
+
+// Flag holding a list of IDs. Comma separated and repeated values are added to
+// the list.
+type IDListFlag []int
+
+func (f *IDListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	ids := []string{}
+	for _, id := range *f {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, ",")
+}
+
+func (f *IDListFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid ID", s)
+		}
+		*f = append(*f, id)
+	}
+	return nil
+}
+
+// Flag holding a list of regular expressions, every repeated value is added to
+// the list
+type RegexpListFlag []*regexp.Regexp
+
+func (f *RegexpListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	res := []string{}
+	for _, re := range *f {
+		res = append(res, re.String())
+	}
+	return strings.Join(res, " ")
+}
+
+func (f *RegexpListFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+func (f *RegexpListFlag) Repeatable() bool {
+	return true
+}
+
+// Flag holding a list of label names, every repeated value is added to the
+// list
+type LabelListFlag []string
+
+func (f *LabelListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *LabelListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *LabelListFlag) Repeatable() bool {
+	return true
+}
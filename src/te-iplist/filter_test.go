@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var filterAgents = []Agent{
+	{AgentID: 1, AgentName: "Tokyo, Japan", Location: "Tokyo Area"},
+	{AgentID: 2, AgentName: "Tokyo Office", Location: "Tokyo Area"},
+	{AgentID: 3, AgentName: "Osaka, Japan", Location: "Osaka Area"},
+	{AgentID: 4, AgentName: "London, UK", Location: "London Area"},
+}
+
+// Returns IDs of Agents matching the filter
+func matchingAgentIDs(filter AgentFilter, agents []Agent) []int {
+	ids := []int{}
+	for _, agent := range agents {
+		if filter.Match(agent) {
+			ids = append(ids, agent.AgentID)
+		}
+	}
+	return ids
+}
+
+// Repeated flags are parsed into lists, and Agents must match every item
+func TestAgentFilterFlags(t *testing.T) {
+
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		{args: []string{}, want: []int{1, 2, 3, 4}},
+		{args: []string{"-agent-id", "1,3", "-agent-id", "4"}, want: []int{1, 3, 4}},
+		{args: []string{"-exclude-agent-id", "2", "-exclude-agent-id", "3"}, want: []int{1, 4}},
+		{args: []string{"-agent-id", "1,2", "-exclude-agent-id", "2"}, want: []int{1}},
+		{args: []string{"-agent-name-regex", "Tokyo"}, want: []int{1, 2}},
+		{args: []string{"-agent-name-regex", "Tokyo", "-agent-name-regex", "Japan"}, want: []int{1}},
+		{args: []string{"-agent-name-regex", "Japan", "-location-regex", "^Osaka"}, want: []int{3}},
+		{args: []string{"-location-regex", "Area$", "-location-regex", "^(Tokyo|London)"}, want: []int{1, 2, 4}},
+		{args: []string{"-agent-id", "4", "-agent-name-regex", "Japan"}, want: []int{}},
+	}
+
+	for _, test := range tests {
+		var agentIDs, excludeAgentIDs IDListFlag
+		var nameRegexps, locationRegexps RegexpListFlag
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Var(&agentIDs, "agent-id", "")
+		flags.Var(&excludeAgentIDs, "exclude-agent-id", "")
+		flags.Var(&nameRegexps, "agent-name-regex", "")
+		flags.Var(&locationRegexps, "location-regex", "")
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatalf("Parse(%q) error: %v", test.args, err)
+		}
+		filter := AgentFilter{AgentIDs: agentIDs, ExcludeAgentIDs: excludeAgentIDs, NameRegexps: nameRegexps, LocationRegexps: locationRegexps}
+		if got := matchingAgentIDs(filter, filterAgents); !slices.Equal(got, test.want) {
+			t.Errorf("Match(%q) = %v, want %v", test.args, got, test.want)
+		}
+	}
+
+}
+
+func TestFlagErrors(t *testing.T) {
+
+	var ids IDListFlag
+	if err := ids.Set("1,x"); err == nil {
+		t.Errorf("IDListFlag.Set(%q) error = nil, want error", "1,x")
+	}
+	var res RegexpListFlag
+	if err := res.Set("(Tokyo"); err == nil {
+		t.Errorf("RegexpListFlag.Set(%q) error = nil, want error", "(Tokyo")
+	}
+
+}
+
+func TestAgentFilterState(t *testing.T) {
+
+	enabled, disabled := true, false
+	agents := []Agent{
+		{AgentID: 1, AgentType: Cloud},
+		{AgentID: 2, AgentState: "Online", Enabled: &enabled, Labels: []Label{{Name: "Prod"}, {Name: "EU"}}},
+		{AgentID: 3, AgentState: "offline", Enabled: &enabled, Labels: []Label{{Name: "prod"}}},
+		{AgentID: 4, AgentState: "online", Enabled: &disabled, Labels: []Label{{Name: "eu"}}},
+	}
+
+	tests := []struct {
+		filter AgentFilter
+		want   []int
+	}{
+		{filter: AgentFilter{OnlineOnly: true}, want: []int{1, 2, 4}},
+		{filter: AgentFilter{EnabledOnly: true}, want: []int{1, 2, 3}},
+		{filter: AgentFilter{OnlineOnly: true, EnabledOnly: true}, want: []int{1, 2}},
+		{filter: AgentFilter{Labels: []string{"PROD"}}, want: []int{2, 3}},
+		{filter: AgentFilter{Labels: []string{"prod", "eu"}}, want: []int{2}},
+		{filter: AgentFilter{Labels: []string{"eu"}, EnabledOnly: true}, want: []int{2}},
+		{filter: AgentFilter{Labels: []string{"missing"}}, want: []int{}},
+	}
+
+	for _, test := range tests {
+		if got := matchingAgentIDs(test.filter, agents); !slices.Equal(got, test.want) {
+			t.Errorf("Match(%+v) = %v, want %v", test.filter, got, test.want)
+		}
+	}
+
+}
+
+// Repeated -label flags are added to the list, not split on commas
+func TestLabelListFlag(t *testing.T) {
+
+	var labels LabelListFlag
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&labels, "label", "")
+	if err := flags.Parse([]string{"-label", "prod", "-label", "eu, west"}); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if want := []string{"prod", "eu, west"}; !slices.Equal(labels, want) {
+		t.Errorf("LabelListFlag = %q, want %q", labels, want)
+	}
+
+}
+
+func TestParseCountries(t *testing.T) {
+
+	tests := []struct {
+		list        []string
+		countries   []string
+		exclude     []string
+		warnedCodes []string
+	}{
+		{list: []string{}, countries: []string{}, exclude: []string{}},
+		{list: []string{"jp", " Gb "}, countries: []string{"JP", "GB"}, exclude: []string{}},
+		{list: []string{"!cn", "JP", "! ru"}, countries: []string{"JP"}, exclude: []string{"CN", "RU"}},
+		{list: []string{"XX", "!uk", "us"}, countries: []string{"XX", "US"}, exclude: []string{"UK"}, warnedCodes: []string{"XX", "UK"}},
+	}
+
+	defer func() { log.Out = io.Discard }()
+	for _, test := range tests {
+		var warnings bytes.Buffer
+		log.Out = &warnings
+		countries, exclude := parseCountries(test.list)
+		if !slices.Equal(countries, test.countries) || !slices.Equal(exclude, test.exclude) {
+			t.Errorf("parseCountries(%q) = %q, %q, want %q, %q", test.list, countries, exclude, test.countries, test.exclude)
+		}
+		if got := strings.Count(warnings.String(), "not an ISO 3166-1"); got != len(test.warnedCodes) {
+			t.Errorf("parseCountries(%q) logged %d warnings, want %d: %s", test.list, got, len(test.warnedCodes), warnings.String())
+		}
+		for _, code := range test.warnedCodes {
+			if !strings.Contains(warnings.String(), "'"+code+"'") {
+				t.Errorf("parseCountries(%q) did not warn about %s: %s", test.list, code, warnings.String())
+			}
+		}
+	}
+
+}
+
+// Country codes are matched regardless of case of both the flag and the API
+func TestAgentFilterCountries(t *testing.T) {
+
+	agents := []Agent{
+		{AgentID: 1, CountryID: "JP"},
+		{AgentID: 2, CountryID: "cn"},
+		{AgentID: 3, CountryID: "GB"},
+		{AgentID: 4},
+	}
+
+	tests := []struct {
+		list []string
+		want []int
+	}{
+		{list: []string{"jp"}, want: []int{1}},
+		{list: []string{"CN", "gb"}, want: []int{2, 3}},
+		{list: []string{"!cn"}, want: []int{1, 3, 4}},
+		{list: []string{"!CN", "!jp"}, want: []int{3, 4}},
+		{list: []string{"jp", "cn", "!CN"}, want: []int{1}},
+	}
+
+	for _, test := range tests {
+		countries, exclude := parseCountries(test.list)
+		filter := AgentFilter{Countries: countries, ExcludeCountries: exclude}
+		if got := matchingAgentIDs(filter, agents); !slices.Equal(got, test.want) {
+			t.Errorf("Match(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+
+}
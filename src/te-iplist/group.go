@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	GroupByAgent     = "agent"
+	GroupByCountry   = "country"
+	GroupByRegion    = "region"
+	GroupByType      = "type"
+	GroupPlaceholder = "{group}"
+	UnknownGroup     = "unknown"
+)
+
+var GroupByTypes = []string{GroupByAgent, GroupByCountry, GroupByRegion, GroupByType}
+
+// Agents sharing an agent, country, region or type
+type AgentGroup struct {
+	Name   string
+	Agents []Agent
+}
+
+// Parses a comma separated list of GroupByTypes
+func parseGroupBy(s string) ([]string, error) {
+	by := []string{}
+	for _, item := range splitList(strings.ToLower(s)) {
+		if !slices.Contains(GroupByTypes, item) {
+			return nil, fmt.Errorf("'%s' not supported. Supported values: %s", item, strings.Join(GroupByTypes, ", "))
+		}
+		by = append(by, item)
+	}
+	return by, nil
+}
+
+// Groups Agents by one or more of agent, country, region and type. Groups are
+// sorted by name, Agents keep their order. Agents without ID are grouped by
+// their exact name, and groups whose names are made equal by file name safe
+// characters get a -2, -3, ... suffix, so their files never overwrite each
+// other.
+func groupAgents(agents []Agent, by []string) []AgentGroup {
+
+	groups := []AgentGroup{}
+	groupIndex := map[string]int{}
+	usedNames := map[string]bool{}
+	for _, agent := range agents {
+		key := agentGroupKey(agent, by)
+		i, ok := groupIndex[key]
+		if !ok {
+			baseName := agentGroupName(agent, by)
+			name := baseName
+			for n := 2; usedNames[name]; n++ {
+				name = baseName + "-" + strconv.Itoa(n)
+			}
+			usedNames[name] = true
+			groups = append(groups, AgentGroup{Name: name})
+			i = len(groups) - 1
+			groupIndex[key] = i
+		}
+		groups[i].Agents = append(groups[i].Agents, agent)
+	}
+	slices.SortFunc(groups, func(a, b AgentGroup) int { return strings.Compare(a.Name, b.Name) })
+
+	return groups
+
+}
+
+// Writes a list per group of Agents, each in a section starting with a
+// # <group> comment line
+func outputGroups(w io.Writer, groups []AgentGroup, output string, opts ListOptions) {
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "%s %s\n", ListCommentChar, group.Name)
+		outputAgents(w, group.Agents, output, opts)
+	}
+}
+
+// Identifies the group of an Agent, Agents are told apart by ID or, without
+// ID, by exact name
+func agentGroupKey(agent Agent, by []string) string {
+	keys := []string{}
+	for _, b := range by {
+		if b != GroupByAgent {
+			keys = append(keys, agentGroupName(agent, []string{b}))
+		} else if agent.AgentID != 0 {
+			keys = append(keys, "id:"+strconv.Itoa(agent.AgentID))
+		} else {
+			keys = append(keys, "name:"+agent.AgentName)
+		}
+	}
+	return strings.Join(keys, "\x00")
+}
+
+// Group name is made of the Agent's values joined with -, i.e. cloud-JP when
+// grouped by type and country. It is safe to use in file names.
+func agentGroupName(agent Agent, by []string) string {
+	names := []string{}
+	for _, b := range by {
+		name := ""
+		switch b {
+		case GroupByAgent:
+			if agent.AgentID != 0 {
+				name = "agent-" + strconv.Itoa(agent.AgentID)
+			} else {
+				// Agents created by -include and convert have no ID
+				name = "agent-" + strings.ToLower(agent.AgentName)
+			}
+		case GroupByCountry:
+			name = strings.ToUpper(agent.CountryID)
+		case GroupByRegion:
+			name = countryRegion(agent.CountryID)
+		case GroupByType:
+			name = agent.AgentType
+		}
+		if name == "" {
+			name = UnknownGroup
+		}
+		names = append(names, unsafeFileNameChars.ReplaceAllString(name, "_"))
+	}
+	return strings.Join(names, "-")
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Largest number of addresses subnets of -include, -include-file and convert
+// may expand to, as every address is handled as an Agent IP
+const MaxSubnetAddresses = 1 << 20
+
+// Creates a synthetic Agent with IPs of included subnets and IP addresses, so
+// they are handled the same way as ThousandEyes Agent IPs in all output types
+func includeAgent(include []netip.Prefix, name string, ipv4, ipv6 bool) (Agent, error) {
+	if !subnetsFit(include) {
+		return Agent{}, fmt.Errorf("included subnets expand to more than %d addresses", MaxSubnetAddresses)
+	}
+	return subnetsAgent(name, include, ipv4, ipv6), nil
+}
+
+// Returns true if subnets have at most MaxSubnetAddresses addresses in total
+func subnetsFit(ipNets []netip.Prefix) bool {
+	// Counted in uint64, as 1<<32 overflows int on 32-bit platforms
+	var addresses uint64
+	for _, ipNet := range ipNets {
+		hostBits := ipNet.Addr().BitLen() - ipNet.Bits()
+		if hostBits > 32 || addresses+(1<<uint(hostBits)) > MaxSubnetAddresses {
+			return false
+		}
+		addresses += 1 << uint(hostBits)
+	}
+	return true
+}
+
+// Creates a synthetic Agent of type custom with every address in the subnets,
+// which must fit in MaxSubnetAddresses
+func subnetsAgent(name string, ipNets []netip.Prefix, ipv4, ipv6 bool) Agent {
+	agent := Agent{AgentName: name, AgentType: Custom}
+	for _, ipNet := range ipNets {
+		agent = addSubnetIPs(agent, ipNet, ipv4, ipv6)
+	}
+	return agent
+}
+
+// Adds every address in the subnet to Agent IPs of the matching version
+func addSubnetIPs(agent Agent, ipNet netip.Prefix, ipv4, ipv6 bool) Agent {
+	if ipNet.Addr().Is4() && !ipv4 || ipNet.Addr().Is6() && !ipv6 {
+		return agent
+	}
+	for ip := ipNet.Addr(); ipNet.Contains(ip); ip = ip.Next() {
+		if ip.Is4() {
+			agent.IPv4Addresses = append(agent.IPv4Addresses, ip)
+		} else {
+			agent.IPv6Addresses = append(agent.IPv6Addresses, ip)
+		}
+	}
+	return agent
+}
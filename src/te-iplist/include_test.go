@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSubnetsFit(t *testing.T) {
+
+	tests := []struct {
+		ipNets []string
+		fit    bool
+	}{
+		{ipNets: []string{"10.0.0.0/12"}, fit: true},
+		{ipNets: []string{"10.0.0.0/12", "10.16.0.1/32"}, fit: false},
+		{ipNets: []string{"10.0.0.0/11"}, fit: false},
+		{ipNets: []string{"0.0.0.0/1"}, fit: false},
+		{ipNets: []string{"0.0.0.0/0"}, fit: false},
+		{ipNets: []string{"2001:db8::/108"}, fit: true},
+		{ipNets: []string{"2001:db8::/64"}, fit: false},
+	}
+
+	for _, test := range tests {
+		if fit := subnetsFit(prefixes(test.ipNets...)); fit != test.fit {
+			t.Errorf("subnetsFit(%v) = %t, want %t", test.ipNets, fit, test.fit)
+		}
+	}
+
+}
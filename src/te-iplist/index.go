@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// Index of Agents by IP address, built once after Agents are fetched and
+// shared by all list output types and lookups, so they do not scan all Agent
+// IPs for every entry
+type AgentIndex struct {
+	agents []Agent
+	byIP   map[netip.Addr][]int
+	// Unique Agent IPs sorted by sortIPs() order, with indexes of Agents that
+	// have the IP at the same position
+	ips      []netip.Addr
+	ipAgents [][]int
+}
+
+func newAgentIndex(agents []Agent) *AgentIndex {
+
+	index := &AgentIndex{agents: agents, byIP: map[netip.Addr][]int{}}
+	for i, agent := range agents {
+		for _, ips := range [][]netip.Addr{agent.IPv4Addresses, agent.IPv6Addresses} {
+			for _, ip := range ips {
+				// Agents are added in order, an IP listed twice by the same Agent is
+				// the last element
+				if n := len(index.byIP[ip]); n == 0 || index.byIP[ip][n-1] != i {
+					index.byIP[ip] = append(index.byIP[ip], i)
+				}
+			}
+		}
+	}
+
+	index.ips = make([]netip.Addr, 0, len(index.byIP))
+	for ip := range index.byIP {
+		index.ips = append(index.ips, ip)
+	}
+	slices.SortFunc(index.ips, netip.Addr.Compare)
+	index.ipAgents = make([][]int, len(index.ips))
+	for i, ip := range index.ips {
+		index.ipAgents[i] = index.byIP[ip]
+	}
+
+	return index
+
+}
+
+// Returns unique IPs of all Agents, IPv4 addresses first
+func (index *AgentIndex) IPs() []netip.Addr {
+	return slices.Clone(index.ips)
+}
+
+// Returns all Agents with provided IP, in the order Agents were fetched
+func (index *AgentIndex) ByIP(ip netip.Addr) []Agent {
+	return index.agentsAt(index.byIP[ip])
+}
+
+// Returns all Agents that have an IP inside provided subnet
+func (index *AgentIndex) BySubnet(ipNet netip.Prefix) []Agent {
+	return index.agentsAt(index.between(ipNet.Masked().Addr(), lastAddr(ipNet)))
+}
+
+// Returns all Agents that have an IP inside provided IPRange
+func (index *AgentIndex) ByIPRange(ipRange IPRange) []Agent {
+	return index.agentsAt(index.between(ipRange.StartIP, ipRange.EndIP))
+}
+
+// Returns all Agents that have an IP inside provided IPBlock
+func (index *AgentIndex) ByIPBlock(ipBlock IPBlock) []Agent {
+	if ips, ok := ipBlock.cRangeIPs(); ok {
+		agentIndexes := []int{}
+		for _, ip := range ips {
+			agentIndexes = append(agentIndexes, index.byIP[ip]...)
+		}
+		return index.agentsAt(agentIndexes)
+	}
+	return index.ByIPRange(IPRange(ipBlock))
+}
+
+// Indexes of Agents with an IP between start and end IP of the same version
+func (index *AgentIndex) between(start, end netip.Addr) []int {
+	agentIndexes := []int{}
+	i, _ := slices.BinarySearchFunc(index.ips, start, netip.Addr.Compare)
+	for ; i < len(index.ips) && index.ips[i].Compare(end) <= 0; i++ {
+		agentIndexes = append(agentIndexes, index.ipAgents[i]...)
+	}
+	return agentIndexes
+}
+
+// Agents at provided indexes, once each and in the order Agents were fetched
+func (index *AgentIndex) agentsAt(agentIndexes []int) []Agent {
+	agentIndexes = slices.Clone(agentIndexes)
+	slices.Sort(agentIndexes)
+	returnAgents := []Agent{}
+	for _, i := range slices.Compact(agentIndexes) {
+		returnAgents = append(returnAgents, index.agents[i])
+	}
+	return returnAgents
+}
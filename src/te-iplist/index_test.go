@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestAgentIndex(t *testing.T) {
+
+	agents := []Agent{
+		{AgentName: "a", IPv4Addresses: addrs("10.0.0.1", "10.0.1.20", "10.0.0.1")},
+		{AgentName: "b", IPv4Addresses: addrs("10.0.0.2", "10.0.2.20"), IPv6Addresses: addrs("2001:db8::5")},
+		{AgentName: "c", IPv4Addresses: addrs("10.0.0.3", "10.0.1.21"), IPv6Addresses: addrs("2001:db8::7", "2001:db8::1:0")},
+		{AgentName: "d", IPv4Addresses: addrs("10.0.0.2")},
+	}
+	index := newAgentIndex(agents)
+
+	tests := []struct {
+		name  string
+		found []Agent
+		want  []string
+	}{
+		{name: "ip", found: index.ByIP(netip.MustParseAddr("10.0.0.2")), want: []string{"b", "d"}},
+		{name: "ip not found", found: index.ByIP(netip.MustParseAddr("10.0.0.4")), want: []string{}},
+		{name: "subnet", found: index.BySubnet(netip.MustParsePrefix("10.0.0.0/31")), want: []string{"a"}},
+		{name: "subnet not masked", found: index.BySubnet(netip.MustParsePrefix("10.0.1.21/23")), want: []string{"a", "b", "c", "d"}},
+		{name: "subnet single ip", found: index.BySubnet(netip.MustParsePrefix("10.0.1.21/32")), want: []string{"c"}},
+		{name: "subnet ipv6", found: index.BySubnet(netip.MustParsePrefix("2001:db8::/112")), want: []string{"b", "c"}},
+		{name: "subnet other version", found: index.BySubnet(netip.MustParsePrefix("::/0")), want: []string{"b", "c"}},
+		{name: "range", found: index.ByIPRange(IPRange{netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("10.0.1.20")}), want: []string{"a", "c"}},
+		{name: "range ipv6", found: index.ByIPRange(IPRange{netip.MustParseAddr("2001:db8::6"), netip.MustParseAddr("2001:db8::1:0")}), want: []string{"c"}},
+		{name: "block d part", found: index.ByIPBlock(IPBlock{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.3")}), want: []string{"b", "c", "d"}},
+		// Addresses between 10.0.1.20 and 10.0.2.20 outside the block are not matched
+		{name: "block c part", found: index.ByIPBlock(IPBlock{netip.MustParseAddr("10.0.1.20"), netip.MustParseAddr("10.0.2.20")}), want: []string{"a", "b"}},
+		{name: "block ipv6", found: index.ByIPBlock(IPBlock{netip.MustParseAddr("2001:db8::5"), netip.MustParseAddr("2001:db8::6")}), want: []string{"b"}},
+	}
+
+	for _, test := range tests {
+		if got := agentNames(test.found); !slices.Equal(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if ips, want := index.IPs(), addrs("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.20", "10.0.1.21", "10.0.2.20", "2001:db8::5", "2001:db8::7", "2001:db8::1:0"); !slices.Equal(ips, want) {
+		t.Errorf("IPs() = %v, want %v", ips, want)
+	}
+
+}
+
+// Compares the index with a linear scan of all Agent IPs
+func TestAgentIndexLinear(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(5, 6))
+	for range 200 {
+		agents := randomAgents(r, 1+r.IntN(20), 4)
+		index := newAgentIndex(agents)
+		for range 20 {
+			ip := netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(4)), byte(r.IntN(256))})
+			ipNet := netip.PrefixFrom(ip, 22+r.IntN(11)).Masked()
+			ipRange := IPRange{ip, ip}
+			for range r.IntN(300) {
+				ipRange.EndIP = ipRange.EndIP.Next()
+			}
+			ipBlock := IPBlock{ip, netip.AddrFrom4([4]byte{10, 0, byte(int(ip.As4()[2]) + r.IntN(4-int(ip.As4()[2]))), ip.As4()[3]})}
+
+			if got, want := agentNames(index.BySubnet(ipNet)), agentNames(linearAgentsBy(agents, ipNet.Contains)); !slices.Equal(got, want) {
+				t.Fatalf("BySubnet(%s) = %v, want %v", ipNet, got, want)
+			}
+			if got, want := agentNames(index.ByIPRange(ipRange)), agentNames(linearAgentsBy(agents, ipRange.Contains)); !slices.Equal(got, want) {
+				t.Fatalf("ByIPRange(%s) = %v, want %v", ipRange, got, want)
+			}
+			if got, want := agentNames(index.ByIPBlock(ipBlock)), agentNames(linearAgentsBy(agents, ipBlock.Contains)); !slices.Equal(got, want) {
+				t.Fatalf("ByIPBlock(%s) = %v, want %v", ipBlock, got, want)
+			}
+		}
+	}
+
+}
+
+// Compares -n lookups of strict subnet entries with a linear scan of all Agent
+// IPs for every entry, as done before AgentIndex
+func BenchmarkAgentIndex(b *testing.B) {
+
+	agents := randomAgents(rand.New(rand.NewPCG(7, 8)), 2000, 64)
+	ipNets := ipsToSubnetsStrict(newAgentIndex(agents).IPs())
+
+	b.Run("index", func(b *testing.B) {
+		for range b.N {
+			index := newAgentIndex(agents)
+			for _, ipNet := range ipNets {
+				index.BySubnet(ipNet)
+			}
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for range b.N {
+			for _, ipNet := range ipNets {
+				linearAgentsBy(agents, ipNet.Contains)
+			}
+		}
+	})
+
+}
+
+// Agents with up to 5 IPv4 addresses in the first C parts of 10.0.0.0/8
+func randomAgents(r *rand.Rand, n, cParts int) []Agent {
+	agents := []Agent{}
+	for i := range n {
+		agent := Agent{AgentName: fmt.Sprintf("agent-%d", i)}
+		for range 1 + r.IntN(5) {
+			agent.IPv4Addresses = append(agent.IPv4Addresses, netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(cParts)), byte(r.IntN(256))}))
+		}
+		agents = append(agents, agent)
+	}
+	return agents
+}
+
+// Agents that have an IP matching contains, by scanning all Agent IPs
+func linearAgentsBy(agents []Agent, contains func(netip.Addr) bool) []Agent {
+	returnAgents := []Agent{}
+	for _, agent := range agents {
+		if slices.ContainsFunc(agent.IPv4Addresses, contains) || slices.ContainsFunc(agent.IPv6Addresses, contains) {
+			returnAgents = append(returnAgents, agent)
+		}
+	}
+	return returnAgents
+}
+
+func agentNames(agents []Agent) []string {
+	names := []string{}
+	for _, agent := range agents {
+		names = append(names, agent.AgentName)
+	}
+	return names
+}
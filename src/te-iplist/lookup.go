@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	LookupExact = "exact"
+	LookupLoose = "loose"
+	LookupNone  = "none"
+)
+
+// Entry of a subnet, range or block list output type
+type ListEntry interface {
+	Contains(ip netip.Addr) bool
+	String() string
+}
+
+// Entries of the list output type sorted by their first address, so the
+// entries containing an IP are found with binary search instead of scanning
+// all entries for every looked up IP
+type LookupEntries struct {
+	entries []ListEntry
+	// Positions in entries, with first and last addresses and the highest last
+	// address of all entries up to the same position
+	order   []int
+	starts  []netip.Addr
+	maxEnds []netip.Addr
+}
+
+func newLookupEntries(entries []ListEntry) *LookupEntries {
+
+	lookupEntries := &LookupEntries{entries: entries}
+	starts, ends := make([]netip.Addr, len(entries)), make([]netip.Addr, len(entries))
+	for i, entry := range entries {
+		starts[i], ends[i] = listEntryBounds(entry)
+		lookupEntries.order = append(lookupEntries.order, i)
+	}
+	slices.SortStableFunc(lookupEntries.order, func(a, b int) int {
+		return starts[a].Compare(starts[b])
+	})
+	for i, j := range lookupEntries.order {
+		maxEnd := ends[j]
+		if i > 0 && lookupEntries.maxEnds[i-1].Compare(maxEnd) > 0 {
+			maxEnd = lookupEntries.maxEnds[i-1]
+		}
+		lookupEntries.starts = append(lookupEntries.starts, starts[j])
+		lookupEntries.maxEnds = append(lookupEntries.maxEnds, maxEnd)
+	}
+
+	return lookupEntries
+
+}
+
+// First and last address of a subnet, range or block
+func listEntryBounds(entry ListEntry) (netip.Addr, netip.Addr) {
+	switch e := entry.(type) {
+	case netip.Prefix:
+		return e.Masked().Addr(), lastAddr(e)
+	case IPRange:
+		return e.StartIP, e.EndIP
+	case IPBlock:
+		return e.StartIP, e.EndIP
+	}
+	return netip.Addr{}, netip.Addr{}
+}
+
+// Returns the entry containing ip that comes first in the list output, or nil
+func (lookupEntries *LookupEntries) Find(ip netip.Addr) ListEntry {
+
+	// Entries starting after ip do not contain it, and neither do entries
+	// before the last position whose highest last address is lower than ip.
+	// Blocks with a C part range may contain addresses of other entries
+	// between their first and last address, so every candidate is checked.
+	found := -1
+	i, ok := slices.BinarySearchFunc(lookupEntries.starts, ip, netip.Addr.Compare)
+	if ok {
+		// Last entry starting with ip
+		for i < len(lookupEntries.starts) && lookupEntries.starts[i] == ip {
+			i++
+		}
+	}
+	for i--; i >= 0 && lookupEntries.maxEnds[i].Compare(ip) >= 0; i-- {
+		j := lookupEntries.order[i]
+		if (found == -1 || j < found) && lookupEntries.entries[j].Contains(ip) {
+			found = j
+		}
+	}
+	if found == -1 {
+		return nil
+	}
+
+	return lookupEntries.entries[found]
+
+}
+
+// Agents an IP address belongs to. Match is exact if the IP is an Agent IP, or
+// loose if it is only covered by Entry of the list output type.
+type LookupResult struct {
+	IP     netip.Addr
+	Match  string
+	Entry  ListEntry
+	Agents []Agent
+}
+
+// Collects IP addresses to look up from arguments. Arguments that are not IP
+// addresses are read as files, i.e. logs, and "-" as standard input. Every IP
+// address found in a file is looked up once.
+func lookupIPs(args []string) ([]netip.Addr, error) {
+
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	ips := []netip.Addr{}
+	seen := map[netip.Addr]bool{}
+	for _, arg := range args {
+		if ip, err := parseIP(arg); err == nil {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+			continue
+		}
+		var r io.Reader
+		if arg == "-" {
+			r = os.Stdin
+		} else {
+			f, err := os.Open(arg)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			for _, ip := range findIPs(scanner.Text()) {
+				if !seen[ip] {
+					seen[ip] = true
+					ips = append(ips, ip)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ips, nil
+
+}
+
+// Finds IP addresses in a line of text, i.e. a log line. Addresses may be
+// followed by a port, as in 192.0.2.1:443 or [2001:db8::1]:443.
+func findIPs(line string) []netip.Addr {
+
+	ips := []netip.Addr{}
+	words := strings.FieldsFunc(line, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r == '.' || r == ':')
+	})
+	for _, word := range words {
+		word = strings.TrimRight(word, ".")
+		ip, err := parseIP(word)
+		if err != nil && strings.Count(word, ":") == 1 {
+			// IPv4 address and port
+			ip, err = parseIP(word[:strings.Index(word, ":")])
+		}
+		if err == nil && !ip.IsUnspecified() {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+
+}
+
+// Entries of the list output type that loose matches are looked up in
+func lookupEntries(index *AgentIndex, output string, opts ListOptions) (*LookupEntries, error) {
+
+	ips := index.IPs()
+	entries := []ListEntry{}
+	switch strings.ToLower(output) {
+	case IPList:
+	case SubnetListStrict, SubnetListLoose, SubnetListOptimal:
+		var ipNets []netip.Prefix
+		if strings.ToLower(output) == SubnetListStrict {
+			ipNets = ipsToSubnetsStrict(ips)
+		} else if strings.ToLower(output) == SubnetListLoose {
+			ipNets = ipsToSubnetsLoose(ips, opts.Loose)
+		} else {
+			ipNets = ipsToSubnetsOptimal(ips)
+		}
+		for _, ipNet := range budgetSubnets(ips, ipNets, opts.MaxEntries, opts.Budget) {
+			entries = append(entries, ipNet)
+		}
+	case IPRangeListStrict, IPRangeListLoose:
+		var ipRanges []IPRange
+		if strings.ToLower(output) == IPRangeListStrict {
+			ipRanges = ipsToIPRangesStrict(ips)
+		} else {
+			ipRanges = ipsToIPRangesLoose(ips, opts.Loose)
+		}
+		for _, ipRange := range budgetIPRanges(ips, ipRanges, opts.MaxEntries, opts.Budget) {
+			entries = append(entries, ipRange)
+		}
+	case IPBlockListStrict, IPBlockListLoose:
+		var ipBlocks []IPBlock
+		if strings.ToLower(output) == IPBlockListStrict {
+			ipBlocks = ipsToIPBlocksStrict(ips)
+		} else {
+			ipBlocks = ipsToIPBlocksLoose(ips, opts.Loose)
+		}
+		for _, ipBlock := range ipBlocks {
+			entries = append(entries, ipBlock)
+		}
+	default:
+		return nil, fmt.Errorf("lookup supports only %s, %s, %s, %s, %s, %s, %s and %s output types", IPList, SubnetListStrict, SubnetListLoose, SubnetListOptimal, IPRangeListStrict, IPRangeListLoose, IPBlockListStrict, IPBlockListLoose)
+	}
+
+	return newLookupEntries(entries), nil
+
+}
+
+// Looks up Agents an IP address belongs to, either as an Agent IP or through
+// an entry of the list output type
+func lookupIP(index *AgentIndex, entries *LookupEntries, ip netip.Addr) LookupResult {
+
+	if agentsWithIP := index.ByIP(ip); len(agentsWithIP) > 0 {
+		return LookupResult{IP: ip, Match: LookupExact, Agents: agentsWithIP}
+	}
+	if entry := entries.Find(ip); entry != nil {
+		var agentsWithIP []Agent
+		switch e := entry.(type) {
+		case netip.Prefix:
+			agentsWithIP = index.BySubnet(e)
+		case IPRange:
+			agentsWithIP = index.ByIPRange(e)
+		case IPBlock:
+			agentsWithIP = index.ByIPBlock(e)
+		}
+		return LookupResult{IP: ip, Match: LookupLoose, Entry: entry, Agents: agentsWithIP}
+	}
+
+	return LookupResult{IP: ip, Match: LookupNone}
+
+}
+
+func outputLookup(w io.Writer, index *AgentIndex, ips []netip.Addr, output string, opts ListOptions) error {
+
+	entries, err := lookupEntries(index, output, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		result := lookupIP(index, entries, ip)
+		via := ""
+		if result.Match == LookupLoose {
+			via = " via " + result.Entry.String()
+		}
+		if len(result.Agents) == 0 {
+			fmt.Fprintf(w, "%s %s\n", pad(ip.String(), 39), result.Match)
+		}
+		for _, agent := range result.Agents {
+			fmt.Fprintf(w, "%s %s %s (%s, %s, %s)%s\n", pad(ip.String(), 39), pad(result.Match, 5), agent.AgentName, agent.AgentType, agent.Location, agent.CountryID, via)
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+)
+
+// Compares binary search of entries with a scan of all entries in list order
+func TestLookupEntriesFind(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(9, 10))
+	for range 500 {
+		ips := newAgentIndex(randomAgents(r, 1+r.IntN(10), 4)).IPs()
+		opts := DefaultLooseOptions
+		opts.MinPrefixV4 = 20 + r.IntN(8)
+		entryLists := [][]ListEntry{}
+		for _, ipNets := range [][]netip.Prefix{ipsToSubnetsStrict(ips), ipsToSubnetsLoose(ips, opts)} {
+			entries := []ListEntry{}
+			for _, ipNet := range ipNets {
+				entries = append(entries, ipNet)
+			}
+			entryLists = append(entryLists, entries)
+		}
+		for _, ipBlocks := range [][]IPBlock{ipsToIPBlocksStrict(ips), ipsToIPBlocksLoose(ips, opts)} {
+			entries := []ListEntry{}
+			for _, ipBlock := range ipBlocks {
+				entries = append(entries, ipBlock)
+			}
+			entryLists = append(entryLists, entries)
+		}
+
+		for _, entries := range entryLists {
+			lookupEntries := newLookupEntries(entries)
+			for range 50 {
+				ip := netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(5)), byte(r.IntN(256))})
+				var want ListEntry
+				for _, entry := range entries {
+					if entry.Contains(ip) {
+						want = entry
+						break
+					}
+				}
+				if got := lookupEntries.Find(ip); got != want {
+					t.Fatalf("Find(%s) in %v = %v, want %v", ip, entries, got, want)
+				}
+			}
+		}
+	}
+
+}
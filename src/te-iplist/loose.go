@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+)
+
+// LooseOptions control how loose output types trade accuracy for shorter lists
+type LooseOptions struct {
+	// Widest prefix length of subnets created for IPv4 and IPv6
+	MinPrefixV4 int
+	MinPrefixV6 int
+	// Average number of addresses between IPv4 addresses joined in a range, 0
+	// for no limit in BudgetOptions
+	MaxGap int
+	// Largest ratio of addresses not used by Agents in a subnet, range or block
+	MaxOvercoverRatio float64
+	// Subnets that must not be covered by any subnet, range or block
+	Exclude []netip.Prefix
+}
+
+var DefaultLooseOptions = LooseOptions{MinPrefixV4: 24, MinPrefixV6: 64, MaxGap: 255, MaxOvercoverRatio: 1}
+
+func (opts LooseOptions) Validate() error {
+	if opts.MinPrefixV4 < 0 || opts.MinPrefixV4 > 32 {
+		return errors.New("-min-prefix-v4 must be between 0 and 32")
+	}
+	if opts.MinPrefixV6 < 0 || opts.MinPrefixV6 > 128 {
+		return errors.New("-min-prefix-v6 must be between 0 and 128")
+	}
+	if opts.MaxGap < 1 {
+		return errors.New("-max-gap must be at least 1")
+	}
+	if opts.MaxOvercoverRatio < 0 || opts.MaxOvercoverRatio > 1 {
+		return errors.New("-max-overcover-ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Limits of merges made by -max-entries. Prefix length and gap limits apply
+// only if they are set explicitly, as their defaults suit loose output types
+// and would prevent reaching the number of entries, i.e. for Agents spread over
+// many /8 subnets.
+func (opts LooseOptions) BudgetOptions(explicit map[string]bool) LooseOptions {
+	budget := opts
+	if !explicit["min-prefix-v4"] {
+		budget.MinPrefixV4 = 0
+	}
+	if !explicit["min-prefix-v6"] {
+		budget.MinPrefixV6 = 0
+	}
+	if !explicit["max-gap"] {
+		budget.MaxGap = 0
+	}
+	return budget
+}
+
+// Returns true if a subnet with 2^hostBits addresses, hosts of them used by
+// Agents, exceeds MaxOvercoverRatio
+func (opts LooseOptions) overcovered(hosts, hostBits int) bool {
+	return opts.overcoveredRange(hosts, math.Ldexp(1, hostBits))
+}
+
+// Returns true if size addresses, hosts of them used by Agents, exceed
+// MaxOvercoverRatio
+func (opts LooseOptions) overcoveredRange(hosts int, size float64) bool {
+	return (size-float64(hosts))/size > opts.MaxOvercoverRatio
+}
+
+// Number of addresses between two IPs of the same version
+func ipDistance(a, b netip.Addr) float64 {
+	if a.Compare(b) > 0 {
+		a, b = b, a
+	}
+	return uint128FromAddr(b).sub(uint128FromAddr(a)).float64()
+}
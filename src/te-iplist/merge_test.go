@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestIPsToSubnetsStrict(t *testing.T) {
+
+	tests := []struct {
+		ips  []netip.Addr
+		want []netip.Prefix
+	}{
+		{ips: addrs("10.0.0.1"), want: prefixes("10.0.0.1/32")},
+		{ips: addrs("10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"), want: prefixes("10.0.0.0/30", "10.0.0.4/32")},
+		// Addresses aligned on a wide subnet, but followed by few IPs, must not
+		// overflow 2^hostBits on 32-bit platforms
+		{ips: addrs("2001:db8:1::"), want: prefixes("2001:db8:1::/128")},
+		{ips: addrs("::"), want: prefixes("::/128")},
+		{ips: addrs("2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"), want: prefixes("2001:db8::/126")},
+		{ips: addrs("2001:db8::1", "2001:db8::2", "2001:db8::3", "2001:db8::4"), want: prefixes("2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/128")},
+		{ips: addrs("2001:db8::", "2001:db8::1", "2001:db8::3"), want: prefixes("2001:db8::/127", "2001:db8::3/128")},
+		// Run crossing the low 64 bits
+		{ips: addrs("2001:db8:0:0:ffff:ffff:ffff:fffe", "2001:db8:0:0:ffff:ffff:ffff:ffff", "2001:db8:0:1::", "2001:db8:0:1::1"),
+			want: prefixes("2001:db8::ffff:ffff:ffff:fffe/127", "2001:db8:0:1::/127")},
+	}
+
+	for _, test := range tests {
+		if got := ipsToSubnetsStrict(test.ips); !slices.Equal(got, test.want) {
+			t.Errorf("ipsToSubnetsStrict(%v) = %v, want %v", test.ips, got, test.want)
+		}
+	}
+
+}
+
+func TestIPsToSubnetsLoose(t *testing.T) {
+
+	widest := DefaultLooseOptions
+	widest.MinPrefixV4 = 0
+	first := DefaultLooseOptions
+	first.MinPrefixV4 = 1
+
+	tests := []struct {
+		ips  []netip.Addr
+		opts LooseOptions
+		want []netip.Prefix
+	}{
+		{ips: addrs("10.0.0.1", "10.0.0.2", "10.0.1.1"), opts: DefaultLooseOptions, want: prefixes("10.0.0.0/30", "10.0.1.1/32")},
+		// -min-prefix-v4 0 and 1 must not overflow 2^hostBits on 32-bit platforms
+		{ips: addrs("10.0.0.1", "10.0.0.2", "172.16.0.1"), opts: widest, want: prefixes("0.0.0.0/0")},
+		{ips: addrs("10.0.0.1", "10.0.0.2", "172.16.0.1"), opts: first, want: prefixes("10.0.0.0/30", "172.16.0.1/32")},
+	}
+
+	for _, test := range tests {
+		if got := ipsToSubnetsLoose(test.ips, test.opts); !slices.Equal(got, test.want) {
+			t.Errorf("ipsToSubnetsLoose(%v, %d) = %v, want %v", test.ips, test.opts.MinPrefixV4, got, test.want)
+		}
+	}
+
+}
+
+func TestIPsToIPRangesStrict(t *testing.T) {
+
+	tests := []struct {
+		ips  []netip.Addr
+		want []IPRange
+	}{
+		{ips: addrs("10.0.0.1", "10.0.0.2", "10.0.0.4"), want: []IPRange{{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}, {netip.MustParseAddr("10.0.0.4"), netip.MustParseAddr("10.0.0.4")}}},
+		{ips: addrs("10.0.0.255", "10.0.1.0"), want: []IPRange{{netip.MustParseAddr("10.0.0.255"), netip.MustParseAddr("10.0.1.0")}}},
+		// The last IPv4 address and the first IPv6 address are not one after another
+		{ips: addrs("255.255.255.255", "::"), want: []IPRange{{netip.MustParseAddr("255.255.255.255"), netip.MustParseAddr("255.255.255.255")}, {netip.MustParseAddr("::"), netip.MustParseAddr("::")}}},
+		{ips: addrs("2001:db8::ffff:ffff:ffff:ffff", "2001:db8:0:1::", "2001:db8:0:1::2"),
+			want: []IPRange{{netip.MustParseAddr("2001:db8::ffff:ffff:ffff:ffff"), netip.MustParseAddr("2001:db8:0:1::")}, {netip.MustParseAddr("2001:db8:0:1::2"), netip.MustParseAddr("2001:db8:0:1::2")}}},
+	}
+
+	for _, test := range tests {
+		if got := ipsToIPRangesStrict(test.ips); !slices.Equal(got, test.want) {
+			t.Errorf("ipsToIPRangesStrict(%v) = %v, want %v", test.ips, got, test.want)
+		}
+	}
+
+}
+
+func TestIPsToIPBlocksStrict(t *testing.T) {
+
+	tests := []struct {
+		ips  []netip.Addr
+		want []IPBlock
+	}{
+		{ips: addrs("10.0.0.3", "10.0.0.4"), want: []IPBlock{{netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("10.0.0.4")}}},
+		{ips: addrs("10.0.1.3", "10.0.2.3", "10.0.3.3"), want: []IPBlock{{netip.MustParseAddr("10.0.1.3"), netip.MustParseAddr("10.0.3.3")}}},
+		// Consecutive addresses in different C parts are not a block
+		{ips: addrs("10.0.0.255", "10.0.1.0"), want: []IPBlock{{netip.MustParseAddr("10.0.0.255"), netip.MustParseAddr("10.0.0.255")}, {netip.MustParseAddr("10.0.1.0"), netip.MustParseAddr("10.0.1.0")}}},
+		// A range of D parts is not extended with a C part
+		{ips: addrs("10.0.0.1", "10.0.0.2", "10.0.1.1"), want: []IPBlock{{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}, {netip.MustParseAddr("10.0.1.1"), netip.MustParseAddr("10.0.1.1")}}},
+		{ips: addrs("2001:db8::fffe", "2001:db8::ffff", "2001:db8::1:0"),
+			want: []IPBlock{{netip.MustParseAddr("2001:db8::fffe"), netip.MustParseAddr("2001:db8::ffff")}, {netip.MustParseAddr("2001:db8::1:0"), netip.MustParseAddr("2001:db8::1:0")}}},
+		{ips: addrs("2001:db8::1", "2001:db8::2", "2001:db8::4"), want: []IPBlock{{netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2")}, {netip.MustParseAddr("2001:db8::4"), netip.MustParseAddr("2001:db8::4")}}},
+	}
+
+	for _, test := range tests {
+		if got := ipsToIPBlocksStrict(test.ips); !slices.Equal(got, test.want) {
+			t.Errorf("ipsToIPBlocksStrict(%v) = %v, want %v", test.ips, got, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestIPsToSubnetsOptimal(t *testing.T) {
+
+	tests := []struct {
+		ips  []netip.Addr
+		want []netip.Prefix
+	}{
+		{ips: addrs(), want: prefixes()},
+		{ips: addrs("10.0.0.1"), want: prefixes("10.0.0.1/32")},
+		{ips: addrs("10.0.0.0", "10.0.0.1"), want: prefixes("10.0.0.0/31")},
+		{ips: addrs("10.0.0.1", "10.0.0.2"), want: prefixes("10.0.0.1/32", "10.0.0.2/32")},
+		{ips: addrs("10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.5"), want: prefixes("10.0.0.0/30", "10.0.0.5/32")},
+		// Merges across /24 boundaries
+		{ips: addrs("10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"), want: prefixes("10.0.0.254/31", "10.0.1.0/31")},
+		{ips: append(addrRange("10.0.0.0", 256), addrRange("10.0.1.0", 256)...), want: prefixes("10.0.0.0/23")},
+		{ips: addrs("255.255.255.254", "255.255.255.255"), want: prefixes("255.255.255.254/31")},
+		{ips: addrs("2001:db8::", "2001:db8::1", "2001:db8::3"), want: prefixes("2001:db8::/127", "2001:db8::3/128")},
+		{ips: addrs("10.0.0.0", "10.0.0.1", "2001:db8::", "2001:db8::1"), want: prefixes("10.0.0.0/31", "2001:db8::/127")},
+		// IPv4 0.0.0.1 and IPv6 ::1 are never merged
+		{ips: addrs("0.0.0.0", "0.0.0.1", "::", "::1"), want: prefixes("0.0.0.0/31", "::/127")},
+	}
+
+	for _, test := range tests {
+		if got := ipsToSubnetsOptimal(test.ips); !slices.Equal(got, test.want) {
+			t.Errorf("ipsToSubnetsOptimal(%v) = %v, want %v", test.ips, got, test.want)
+		}
+	}
+
+}
+
+// Subnets must cover exactly the provided IPs, and no two of them may be
+// merged into their parent subnet
+func TestIPsToSubnetsOptimalMinimal(t *testing.T) {
+
+	r := rand.New(rand.NewPCG(3, 4))
+	for range 1000 {
+		set := map[netip.Addr]bool{}
+		for range 1 + r.IntN(64) {
+			set[netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(2)), byte(r.IntN(256))})] = true
+		}
+		ips := []netip.Addr{}
+		for ip := range set {
+			ips = append(ips, ip)
+		}
+		ips = sortIPs(ips)
+
+		ipNets := ipsToSubnetsOptimal(ips)
+		covered := 0
+		for i, ipNet := range ipNets {
+			covered += 1 << (32 - ipNet.Bits())
+			if i > 0 && ipNets[i-1].Bits() == ipNet.Bits() {
+				parent, _ := ipNet.Addr().Prefix(ipNet.Bits() - 1)
+				if parent.Contains(ipNets[i-1].Addr()) {
+					t.Fatalf("ipsToSubnetsOptimal(%v) = %v, %s and %s can be merged", ips, ipNets, ipNets[i-1], ipNet)
+				}
+			}
+		}
+		for _, ip := range ips {
+			if !slices.ContainsFunc(ipNets, func(ipNet netip.Prefix) bool { return ipNet.Contains(ip) }) {
+				t.Fatalf("ipsToSubnetsOptimal(%v) = %v does not cover %s", ips, ipNets, ip)
+			}
+		}
+		if covered != len(ips) {
+			t.Fatalf("ipsToSubnetsOptimal(%v) = %v covers %d addresses, want %d", ips, ipNets, covered, len(ips))
+		}
+	}
+
+}
+
+// n consecutive addresses starting with first
+func addrRange(first string, n int) []netip.Addr {
+	ips := []netip.Addr{}
+	for ip := netip.MustParseAddr(first); len(ips) < n; ip = ip.Next() {
+		ips = append(ips, ip)
+	}
+	return ips
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// File written to a temporary file in the same directory and renamed over
+// Path on Commit, so readers never see a partially written file. If the
+// content did not change, Path is left untouched and keeps its mtime. The
+// first write error is kept and returned by Commit, as output is written with
+// fmt.Fprintf without checking errors.
+type AtomicFile struct {
+	Path string
+	tmp  *os.File
+	err  error
+}
+
+func (f *AtomicFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	// Temporary file is created on first write, so errors before any output
+	// do not leave it behind
+	if f.tmp == nil {
+		tmp, err := os.CreateTemp(filepath.Dir(f.Path), "."+filepath.Base(f.Path)+".tmp*")
+		if err != nil {
+			f.err = err
+			return 0, err
+		}
+		f.tmp = tmp
+	}
+	n, err := f.tmp.Write(p)
+	if err != nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Replaces Path with the written content, returns true if the content changed.
+// If any write failed, Path is left untouched and the write error is returned.
+func (f *AtomicFile) Commit() (bool, error) {
+
+	if _, err := f.Write(nil); err != nil {
+		if f.tmp != nil {
+			f.tmp.Close()
+			os.Remove(f.tmp.Name())
+		}
+		return false, err
+	}
+	tmpPath := f.tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := f.tmp.Sync(); err != nil {
+		f.tmp.Close()
+		return false, err
+	}
+	if err := f.tmp.Close(); err != nil {
+		return false, err
+	}
+
+	if sameFileContent(tmpPath, f.Path) {
+		return false, nil
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpPath, f.Path); err != nil {
+		return false, err
+	}
+
+	return true, nil
+
+}
+
+// Returns true if both files exist and have the same content
+func sameFileContent(a, b string) bool {
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil || infoA.Size() != infoB.Size() {
+		return false
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		nA, errA := io.ReadFull(fa, bufA)
+		nB, errB := io.ReadFull(fb, bufB)
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == errA
+		} else if errA != nil || errB != nil {
+			return false
+		}
+	}
+
+}
+
+// Writes data to path atomically, returns true if the content changed
+func writeOutputFile(path string, data []byte) (bool, error) {
+	f := &AtomicFile{Path: path}
+	if _, err := f.Write(data); err != nil {
+		return false, err
+	}
+	return f.Commit()
+}
+
+// Runs -on-change command with the system shell
+func runCommand(command string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFileWriteError(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &AtomicFile{Path: path}
+	fmt.Fprintf(f, "10.0.0.1\n")
+	tmpPath := f.tmp.Name()
+	// Following writes fail, as with a full disk
+	f.tmp.Close()
+	fmt.Fprintf(f, "10.0.0.2\n")
+
+	if changed, err := f.Commit(); err == nil || changed {
+		t.Errorf("Commit() = %t, %v, want write error", changed, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "old\n" {
+		t.Errorf("%s = %q, want unchanged %q", path, string(b), "old\n")
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s was not removed", tmpPath)
+	}
+
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Line of a list written by te-iplist. Entry is an IP address, subnet, IP range
+// or IP block, Comment is the text following # added by -n.
+type ListLine struct {
+	Number  int
+	Entry   string
+	Comment string
+}
+
+// Reads list lines, skipping empty lines and lines with comments only
+func readListLines(r io.Reader) ([]ListLine, error) {
+
+	lines := []ListLine{}
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		entry, comment, _ := strings.Cut(scanner.Text(), ListCommentChar)
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		lines = append(lines, ListLine{Number: number, Entry: entry, Comment: strings.TrimSpace(comment)})
+	}
+
+	return lines, scanner.Err()
+
+}
+
+// Parses a list of entries of any list output type, i.e.
+// "10.0.0.0/8,192.0.2.1,192.0.2.5 - 192.0.2.9"
+func parseIPNets(list []string) ([]netip.Prefix, error) {
+
+	ipNets := []netip.Prefix{}
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		itemIPNets, err := parseListEntry(item)
+		if err != nil {
+			return nil, err
+		}
+		ipNets = append(ipNets, itemIPNets...)
+	}
+
+	return ipNets, nil
+
+}
+
+// Reads entries of any list output type from a file, one or more comma
+// separated per line. Text following # is ignored.
+func readIPNetsFile(path string) ([]netip.Prefix, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines, err := readListLines(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ipNets := []netip.Prefix{}
+	for _, line := range lines {
+		lineIPNets, err := parseIPNets(strings.Split(line.Entry, ","))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line.Number, err.Error())
+		}
+		ipNets = append(ipNets, lineIPNets...)
+	}
+
+	return ipNets, nil
+
+}
+
+// Parses IP address, i.e. 10.0.0.1
+func parseIP(s string) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil || ip.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("'%s' is not a valid IP address", s)
+	}
+	return ip.Unmap(), nil
+}
+
+// Parses subnet, i.e. 10.0.0.0/24. Single IP address is parsed as a host
+// subnet, as written by -o subnet-* output types.
+func parseSubnet(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip, err := parseIP(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+	ipNet, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("'%s' is not a valid subnet", s)
+	}
+	if ipNet.Addr().Is4In6() {
+		ipNet = netip.PrefixFrom(ipNet.Addr().Unmap(), max(ipNet.Bits()-96, 0))
+	}
+	if ipNet != ipNet.Masked() {
+		return netip.Prefix{}, fmt.Errorf("'%s' has host bits set, did you mean %s?", s, ipNet.Masked())
+	}
+	return ipNet, nil
+}
+
+// Parses IP range, i.e. 10.0.0.1 - 10.0.0.9. Single IP address is parsed as a
+// range of one address.
+func parseIPRange(s string) (IPRange, error) {
+	startStr, endStr, found := strings.Cut(s, "-")
+	start, err := parseIP(startStr)
+	if err != nil {
+		return IPRange{}, err
+	}
+	if !found {
+		return IPRange{start, start}, nil
+	}
+	end, err := parseIP(endStr)
+	if err != nil {
+		return IPRange{}, err
+	}
+	if start.Is4() != end.Is4() || start.Compare(end) > 0 {
+		return IPRange{}, fmt.Errorf("'%s' is not a valid IP range", strings.TrimSpace(s))
+	}
+	return IPRange{start, end}, nil
+}
+
+// Parses IP block, i.e. 10.0.0.[1-3], 10.0.[1-2].20 or 2001:db8::[5-7]. Single
+// IP address is parsed as a block of one address.
+func parseIPBlock(s string) (IPBlock, error) {
+
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "[")
+	if open == -1 {
+		ip, err := parseIP(s)
+		return IPBlock{ip, ip}, err
+	}
+	invalid := fmt.Errorf("'%s' is not a valid IP block", s)
+	close := strings.Index(s, "]")
+	if close < open {
+		return IPBlock{}, invalid
+	}
+	startPart, endPart, found := strings.Cut(s[open+1:close], "-")
+	if !found {
+		return IPBlock{}, invalid
+	}
+	prefix, suffix := s[:open], s[close+1:]
+
+	start, err := parseIP(prefix + startPart + suffix)
+	if err != nil {
+		return IPBlock{}, invalid
+	}
+	end, err := parseIP(prefix + endPart + suffix)
+	if err != nil || start.Compare(end) > 0 {
+		return IPBlock{}, invalid
+	}
+
+	validPart := func(part string, base int) bool {
+		_, err := strconv.ParseUint(part, base, 16)
+		return err == nil
+	}
+	if start.Is4() {
+		// Only C or D part may be a range
+		part := strings.Count(prefix, ".")
+		if end.Is6() || !validPart(startPart, 10) || !validPart(endPart, 10) ||
+			!(part == 3 && suffix == "" || part == 2 && strings.Count(suffix, ".") == 1) {
+			return IPBlock{}, invalid
+		}
+	} else if suffix != "" || !validPart(startPart, 16) || !validPart(endPart, 16) {
+		// Only the last IPv6 hextet may be a range
+		return IPBlock{}, invalid
+	}
+
+	return IPBlock{start, end}, nil
+
+}
+
+// Parses an entry of any list output type to subnets that exactly cover it
+func parseListEntry(s string) ([]netip.Prefix, error) {
+
+	if strings.Contains(s, "[") {
+		ipBlock, err := parseIPBlock(s)
+		if err != nil {
+			return nil, err
+		}
+		return ipBlockToSubnets(ipBlock), nil
+	} else if strings.Contains(s, "-") {
+		ipRange, err := parseIPRange(s)
+		if err != nil {
+			return nil, err
+		}
+		return ipRangeToSubnets(ipRange), nil
+	}
+	ipNet, err := parseSubnet(s)
+	if err != nil {
+		return nil, err
+	}
+	return []netip.Prefix{ipNet}, nil
+
+}
+
+// Minimal list of subnets that exactly cover the IP range
+func ipRangeToSubnets(ipRange IPRange) []netip.Prefix {
+
+	ipNets := []netip.Prefix{}
+	is4 := ipRange.StartIP.Is4()
+	maxBits := ipRange.StartIP.BitLen()
+	start, end := uint128FromAddr(ipRange.StartIP), uint128FromAddr(ipRange.EndIP)
+	for start.cmp(end) <= 0 {
+		// Widest subnet aligned on start that does not go past end
+		hostBits := min(start.trailingZeros(), maxBits)
+		size := end.sub(start)
+		for hostBits > 0 && hostMask(hostBits).cmp(size) > 0 {
+			hostBits--
+		}
+		ipNets = append(ipNets, netip.PrefixFrom(start.addr(is4), maxBits-hostBits))
+		next := start.or(hostMask(hostBits)).add64(1)
+		if next.cmp(start) <= 0 {
+			// Last address of IP space
+			break
+		}
+		start = next
+	}
+
+	return ipNets
+
+}
+
+// Minimal list of subnets that exactly cover the IP block
+func ipBlockToSubnets(ipBlock IPBlock) []netip.Prefix {
+
+	if ips, ok := ipBlock.cRangeIPs(); ok {
+		ipNets := []netip.Prefix{}
+		for _, ip := range ips {
+			ipNets = append(ipNets, netip.PrefixFrom(ip, 32))
+		}
+		return ipNets
+	}
+
+	return ipRangeToSubnets(IPRange(ipBlock))
+
+}
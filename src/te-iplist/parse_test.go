@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// Output of IPRange.String() parses back to the same range
+func TestIPRangeRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		s     string
+		start string
+		end   string
+	}{
+		{s: "10.0.0.1 - 10.0.0.9", start: "10.0.0.1", end: "10.0.0.9"},
+		{s: "10.0.0.1", start: "10.0.0.1", end: "10.0.0.1"},
+		{s: "10.0.0.255 - 10.0.1.0", start: "10.0.0.255", end: "10.0.1.0"},
+		{s: "2001:db8::1 - 2001:db8::1:0", start: "2001:db8::1", end: "2001:db8::1:0"},
+		{s: "2001:db8:0:0:1::5 - 2001:db8:0:0:1::7", start: "2001:db8::1:0:0:5", end: "2001:db8::1:0:0:7"},
+	}
+
+	for _, test := range tests {
+		ipRange, err := parseIPRange(test.s)
+		want := IPRange{netip.MustParseAddr(test.start), netip.MustParseAddr(test.end)}
+		if err != nil || ipRange != want {
+			t.Errorf("parseIPRange(%q) = %v, %v, want %v", test.s, ipRange, err, want)
+			continue
+		}
+		if parsed, err := parseIPRange(ipRange.String()); err != nil || parsed != ipRange {
+			t.Errorf("parseIPRange(%q) = %v, %v, want %v", ipRange.String(), parsed, err, ipRange)
+		}
+	}
+
+}
+
+// Output of IPBlock.String() parses back to the same block
+func TestIPBlockRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		s      string
+		start  string
+		end    string
+		String string
+	}{
+		{s: "10.0.0.[1-3]", start: "10.0.0.1", end: "10.0.0.3", String: "10.0.0.[1-3]"},
+		{s: "10.0.[1-2].20", start: "10.0.1.20", end: "10.0.2.20", String: "10.0.[1-2].20"},
+		{s: "10.0.0.1", start: "10.0.0.1", end: "10.0.0.1", String: "10.0.0.1"},
+		{s: "2001:db8::[0-5]", start: "2001:db8::", end: "2001:db8::5", String: "2001:db8::[0-5]"},
+		{s: "2001:db8::[a-ff]", start: "2001:db8::a", end: "2001:db8::ff", String: "2001:db8::[a-ff]"},
+		{s: "2001:db8:0:0:1::[5-7]", start: "2001:db8::1:0:0:5", end: "2001:db8::1:0:0:7", String: "2001:db8::1:0:0:[5-7]"},
+		{s: "2001:0:0:1::[0-5]", start: "2001:0:0:1::", end: "2001:0:0:1::5", String: "2001:0:0:1::[0-5]"},
+		{s: "2001:db8::1", start: "2001:db8::1", end: "2001:db8::1", String: "2001:db8::1"},
+	}
+
+	for _, test := range tests {
+		ipBlock, err := parseIPBlock(test.s)
+		want := IPBlock{netip.MustParseAddr(test.start), netip.MustParseAddr(test.end)}
+		if err != nil || ipBlock != want {
+			t.Errorf("parseIPBlock(%q) = %v, %v, want %v", test.s, ipBlock, err, want)
+			continue
+		}
+		if ipBlock.String() != test.String {
+			t.Errorf("%v.String() = %q, want %q", want, ipBlock.String(), test.String)
+		}
+		if parsed, err := parseIPBlock(ipBlock.String()); err != nil || parsed != ipBlock {
+			t.Errorf("parseIPBlock(%q) = %v, %v, want %v", ipBlock.String(), parsed, err, ipBlock)
+		}
+	}
+
+}
+
+// Blocks written by strict and loose block output types parse back to the same
+// blocks
+func TestIPBlockListRoundTrip(t *testing.T) {
+
+	ips := addrs("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.20", "10.0.2.20", "10.0.3.7", "2001:db8::1", "2001:db8::2", "2001:db8::1:0:0:5", "2001:db8::1:0:0:6")
+	for _, ipBlocks := range [][]IPBlock{ipsToIPBlocksStrict(ips), ipsToIPBlocksLoose(ips, DefaultLooseOptions)} {
+		for _, ipBlock := range ipBlocks {
+			if parsed, err := parseIPBlock(ipBlock.String()); err != nil || parsed != ipBlock {
+				t.Errorf("parseIPBlock(%q) = %v, %v, want %v", ipBlock.String(), parsed, err, ipBlock)
+			}
+		}
+	}
+
+}
+
+func TestParseIPBlockInvalid(t *testing.T) {
+	for _, s := range []string{"10.0.0.[3-1]", "10.[0-1].0.1", "10.0.0.[1-3", "10.0.0.[1]", "10.0.0.[1-300]", "2001:db8::[5-7]:1", "2001:db8::[5-g]"} {
+		if ipBlock, err := parseIPBlock(s); err == nil {
+			t.Errorf("parseIPBlock(%q) = %v, want error", s, ipBlock)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCountryRegions(t *testing.T) {
+
+	if len(countryContinents) != 249 {
+		t.Errorf("countryContinents has %d countries, want all 249 ISO 3166-1 alpha-2 codes", len(countryContinents))
+	}
+	for country, continent := range countryContinents {
+		if len(country) != 2 || country != strings.ToUpper(country) {
+			t.Errorf("%s is not an upper case ISO 3166-1 alpha-2 code", country)
+		}
+		if !slices.Contains(Continents, continent) {
+			t.Errorf("%s continent %s is not one of %v", country, continent, Continents)
+		}
+		// Only Antarctica is in no region
+		if region := countryRegion(country); continent == "AN" && region != "" || continent != "AN" && !slices.Contains(Regions, region) {
+			t.Errorf("countryRegion(%s) = %q", country, region)
+		}
+	}
+	for _, country := range emeaAsiaCountries {
+		if countryContinents[country] != "AS" {
+			t.Errorf("%s is listed in EMEA Asia but is in %s", country, countryContinents[country])
+		}
+	}
+
+	tests := []struct {
+		country   string
+		continent string
+		region    string
+	}{
+		{"JP", "AS", RegionAPAC},
+		{"jp", "AS", RegionAPAC},
+		{"AE", "AS", RegionEMEA},
+		{"DE", "EU", RegionEMEA},
+		{"ZA", "AF", RegionEMEA},
+		{"AU", "OC", RegionAPAC},
+		{"US", "NA", RegionAMER},
+		{"BR", "SA", RegionAMER},
+		{"AQ", "AN", ""},
+		{"XX", "", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if continent, region := countryContinent(test.country), countryRegion(test.country); continent != test.continent || region != test.region {
+			t.Errorf("%q = %q %q, want %q %q", test.country, continent, region, test.continent, test.region)
+		}
+	}
+
+}
+
+func TestGroupAgents(t *testing.T) {
+
+	agents := []Agent{
+		{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, CountryID: "JP"},
+		{AgentID: 2, AgentName: "Frankfurt", AgentType: Cloud, CountryID: "DE"},
+		{AgentID: 3, AgentName: "Office", AgentType: Enterprise, CountryID: "jp"},
+		{AgentID: 4, AgentName: "Unknown"},
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{by: "country", want: []string{"DE: Frankfurt", "JP: Tokyo, Office", "unknown: Unknown"}},
+		{by: "region", want: []string{"APAC: Tokyo, Office", "EMEA: Frankfurt", "unknown: Unknown"}},
+		{by: "TYPE,region", want: []string{"cloud-APAC: Tokyo", "cloud-EMEA: Frankfurt", "enterprise-APAC: Office", "unknown-unknown: Unknown"}},
+		{by: "agent", want: []string{"agent-1: Tokyo", "agent-2: Frankfurt", "agent-3: Office", "agent-4: Unknown"}},
+	}
+
+	for _, test := range tests {
+		by, err := parseGroupBy(test.by)
+		if err != nil {
+			t.Fatalf("parseGroupBy(%q) error = %v", test.by, err)
+		}
+		got := []string{}
+		for _, group := range groupAgents(agents, by) {
+			got = append(got, group.Name+": "+strings.Join(agentNames(group.Agents), ", "))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("groupAgents(%q) = %q, want %q", test.by, got, test.want)
+		}
+	}
+
+	if _, err := parseGroupBy("city"); err == nil {
+		t.Errorf("parseGroupBy(city) returned no error")
+	}
+
+}
+
+// -group-by writes a section per group in every list output type
+func TestOutputGroups(t *testing.T) {
+
+	groups := groupAgents([]Agent{
+		{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, CountryID: "JP", IPv4Addresses: addrs("192.0.2.1", "192.0.2.2")},
+		{AgentID: 2, AgentName: "Frankfurt", AgentType: Cloud, CountryID: "DE", IPv4Addresses: addrs("198.51.100.7"), IPv6Addresses: addrs("2001:db8::1")},
+	}, []string{GroupByCountry})
+
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: IPList, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.1\n192.0.2.2\n"},
+		{output: SubnetListStrict, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.1\n192.0.2.2\n"},
+		{output: SubnetListLoose, want: "# DE\n198.51.100.7\n2001:db8::/64\n\n# JP\n192.0.2.0/30\n"},
+		{output: SubnetListOptimal, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.1\n192.0.2.2\n"},
+		{output: IPRangeListStrict, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.1 - 192.0.2.2\n"},
+		{output: IPRangeListLoose, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.1 - 192.0.2.2\n"},
+		{output: IPBlockListStrict, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.[1-2]\n"},
+		{output: IPBlockListLoose, want: "# DE\n198.51.100.7\n2001:db8::1\n\n# JP\n192.0.2.[1-2]\n"},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		outputGroups(&b, groups, test.output, ListOptions{Loose: DefaultLooseOptions})
+		// Block lists pad entries to a fixed width
+		if got := trailingSpaces.ReplaceAllString(b.String(), ""); got != test.want {
+			t.Errorf("%s: outputGroups() = %q, want %q", test.output, got, test.want)
+		}
+	}
+
+}
+
+var trailingSpaces = regexp.MustCompile(`(?m) +$`)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Manifest written to -out-dir, listing files written by -split-by
+const ManifestFileName = "index.json"
+
+type Manifest struct {
+	Output  string         `json:"output"`
+	SplitBy []string       `json:"splitBy"`
+	Files   []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	File   string         `json:"file"`
+	Group  string         `json:"group"`
+	SHA256 string         `json:"sha256"`
+	Agents []AgentSummary `json:"agents"`
+}
+
+// Writes a file in the output type per group of Agents to dir, named by the
+// group, i.e. cloud-JP.txt, and a manifest listing the files. Files listed by
+// the previous manifest whose group no longer has Agents are removed. Returns
+// true if any file changed.
+func splitOutput(dir string, agents []Agent, by []string, output string, opts ListOptions) (bool, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+
+	var previous Manifest
+	if b, err := os.ReadFile(filepath.Join(dir, ManifestFileName)); err == nil {
+		json.Unmarshal(b, &previous)
+	}
+
+	changed := false
+	manifest := Manifest{Output: strings.ToLower(output), SplitBy: by, Files: []ManifestFile{}}
+	for _, group := range groupAgents(agents, by) {
+		var b bytes.Buffer
+		outputAgents(&b, group.Agents, output, opts)
+		file := group.Name + "." + outputExtension(output)
+		fileChanged, err := writeOutputFile(filepath.Join(dir, file), b.Bytes())
+		if err != nil {
+			return false, err
+		}
+		changed = changed || fileChanged
+
+		sum := sha256.Sum256(b.Bytes())
+		manifestFile := ManifestFile{File: file, Group: group.Name, SHA256: hex.EncodeToString(sum[:])}
+		for _, agent := range group.Agents {
+			manifestFile.Agents = append(manifestFile.Agents, AgentSummary{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType})
+		}
+		manifest.Files = append(manifest.Files, manifestFile)
+	}
+
+	for _, previousFile := range previous.Files {
+		if !slices.ContainsFunc(manifest.Files, func(f ManifestFile) bool { return f.File == previousFile.File }) {
+			if os.Remove(filepath.Join(dir, filepath.Base(previousFile.File))) == nil {
+				changed = true
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	manifestChanged, err := writeOutputFile(filepath.Join(dir, ManifestFileName), append(b, '\n'))
+
+	return changed || manifestChanged, err
+
+}
+
+// File name extension of the output type
+func outputExtension(output string) string {
+	switch strings.ToLower(output) {
+	case CSV, JSON, XML:
+		return strings.ToLower(output)
+	}
+	return "txt"
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitOutput(t *testing.T) {
+
+	agents := []Agent{
+		{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, CountryID: "JP", IPv4Addresses: addrs("192.0.2.1")},
+		{AgentID: 2, AgentName: "Osaka", AgentType: Cloud, CountryID: "jp", IPv4Addresses: addrs("192.0.2.2")},
+		{AgentID: 3, AgentName: "Office", AgentType: Enterprise, CountryID: "US", IPv4Addresses: addrs("198.51.100.1")},
+		{AgentName: "My hosts", AgentType: Custom, IPv4Addresses: addrs("203.0.113.1")},
+	}
+
+	tests := []struct {
+		by     []string
+		files  []string
+		groups map[string][]string
+	}{
+		{
+			by:     []string{GroupByAgent},
+			files:  []string{"agent-1.txt", "agent-2.txt", "agent-3.txt", "agent-my_hosts.txt"},
+			groups: map[string][]string{"agent-1": {"Tokyo"}, "agent-my_hosts": {"My hosts"}},
+		},
+		{
+			by:     []string{GroupByCountry},
+			files:  []string{"JP.txt", "US.txt", "unknown.txt"},
+			groups: map[string][]string{"JP": {"Tokyo", "Osaka"}, "unknown": {"My hosts"}},
+		},
+		{
+			by:     []string{GroupByType},
+			files:  []string{"cloud.txt", "custom.txt", "enterprise.txt"},
+			groups: map[string][]string{"cloud": {"Tokyo", "Osaka"}, "enterprise": {"Office"}},
+		},
+		{
+			by:     []string{GroupByType, GroupByCountry},
+			files:  []string{"cloud-JP.txt", "custom-unknown.txt", "enterprise-US.txt"},
+			groups: map[string][]string{"cloud-JP": {"Tokyo", "Osaka"}},
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		changed, err := splitOutput(dir, agents, test.by, IPList, ListOptions{})
+		if err != nil || !changed {
+			t.Fatalf("splitOutput(%v) = %t, %v, want changed", test.by, changed, err)
+		}
+
+		manifest := readManifest(t, dir)
+		files := []string{}
+		for _, file := range manifest.Files {
+			files = append(files, file.File)
+			if want, ok := test.groups[file.Group]; ok && !slices.Equal(summaryNames(file.Agents), want) {
+				t.Errorf("%v: %s Agents = %v, want %v", test.by, file.Group, summaryNames(file.Agents), want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, file.File)); err != nil {
+				t.Errorf("%v: %s listed in the manifest was not written", test.by, file.File)
+			}
+		}
+		if !slices.Equal(files, test.files) || !slices.Equal(manifest.SplitBy, test.by) || manifest.Output != IPList {
+			t.Errorf("%v: manifest = %+v, want files %v", test.by, manifest, test.files)
+		}
+
+		if changed, err := splitOutput(dir, agents, test.by, IPList, ListOptions{}); err != nil || changed {
+			t.Errorf("%v: second splitOutput() = %t, %v, want unchanged", test.by, changed, err)
+		}
+	}
+
+}
+
+// Files of groups without Agents are removed on the next run
+func TestSplitOutputRemovesStaleFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	agents := []Agent{
+		{AgentID: 1, AgentName: "Tokyo", AgentType: Cloud, CountryID: "JP", IPv4Addresses: addrs("192.0.2.1")},
+		{AgentID: 3, AgentName: "Office", AgentType: Enterprise, CountryID: "US", IPv4Addresses: addrs("198.51.100.1")},
+	}
+	if _, err := splitOutput(dir, agents, []string{GroupByCountry}, IPList, ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := splitOutput(dir, agents[:1], []string{GroupByCountry}, IPList, ListOptions{})
+	if err != nil || !changed {
+		t.Fatalf("splitOutput() = %t, %v, want changed", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "US.txt")); !os.IsNotExist(err) {
+		t.Errorf("US.txt was not removed")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "JP.txt")); string(b) != "192.0.2.1\n" {
+		t.Errorf("JP.txt = %q, want %q", string(b), "192.0.2.1\n")
+	}
+
+}
+
+// Agents without ID whose names map to the same file name get separate files
+func TestSplitOutputNameCollisions(t *testing.T) {
+
+	dir := t.TempDir()
+	agents := []Agent{
+		{AgentName: "Office A", AgentType: Custom, IPv4Addresses: addrs("192.0.2.1")},
+		{AgentName: "office a", AgentType: Custom, IPv4Addresses: addrs("192.0.2.2")},
+		{AgentName: "office_a", AgentType: Custom, IPv4Addresses: addrs("192.0.2.3")},
+		{AgentName: "123", AgentType: Custom, IPv4Addresses: addrs("192.0.2.4")},
+		{AgentID: 123, AgentName: "Tokyo", AgentType: Cloud, IPv4Addresses: addrs("192.0.2.5")},
+	}
+	if _, err := splitOutput(dir, agents, []string{GroupByAgent}, IPList, ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"agent-office_a.txt":   "192.0.2.1\n",
+		"agent-office_a-2.txt": "192.0.2.2\n",
+		"agent-office_a-3.txt": "192.0.2.3\n",
+		"agent-123.txt":        "192.0.2.4\n",
+		"agent-123-2.txt":      "192.0.2.5\n",
+	}
+	manifest := readManifest(t, dir)
+	if len(manifest.Files) != len(want) {
+		t.Errorf("manifest lists %d files, want %d", len(manifest.Files), len(want))
+	}
+	for file, content := range want {
+		if b, _ := os.ReadFile(filepath.Join(dir, file)); string(b) != content {
+			t.Errorf("%s = %q, want %q", file, string(b), content)
+		}
+	}
+
+}
+
+func readManifest(t *testing.T, dir string) Manifest {
+	var manifest Manifest
+	b, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err == nil {
+		err = json.Unmarshal(b, &manifest)
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", ManifestFileName, err)
+	}
+	return manifest
+}
+
+func summaryNames(agents []AgentSummary) []string {
+	names := []string{}
+	for _, agent := range agents {
+		names = append(names, agent.AgentName)
+	}
+	return names
+}
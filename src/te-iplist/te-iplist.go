@@ -1,31 +1,34 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
-	"math"
+	"io"
+	"math/bits"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"regexp"
 	"runtime"
 	"slices"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	Ver               = "1.1.3"
 	ApiUrl            = "https://api.thousandeyes.com"
+	TokenEnvVar       = "TE_TOKEN"
 	IPList            = "ip"
 	SubnetListStrict  = "subnet-strict"
 	SubnetListLoose   = "subnet-loose"
+	SubnetListOptimal = "subnet-optimal"
 	IPRangeListStrict = "range-strict"
 	IPRangeListLoose  = "range-loose"
 	IPBlockListStrict = "block-strict"
@@ -33,16 +36,31 @@ const (
 	CSV               = "csv"
 	JSON              = "json"
 	XML               = "xml"
+	YAML              = "yaml"
 	Enterprise        = "enterprise"
 	EnterpriseCluster = "enterprise-cluster"
 	Cloud             = "cloud"
+	Custom            = "custom"
+	AgentStateOnline  = "online"
+	Convert           = "convert"
+	Lookup            = "lookup"
+	Annotate          = "annotate"
 	Default           = "default"
+	All               = "all"
 	ListCommentChar   = "#"
 	ListSeparatorChar = ";"
 	CSVSeparatorChar  = ","
 )
 
+// Account Groups fetched at the same time, so -aid all does not exceed the API
+// rate limit
+const MaxConcurrentRequests = 4
+
+var OutputTypes = []string{IPList, SubnetListStrict, SubnetListLoose, SubnetListOptimal, IPRangeListStrict, IPRangeListLoose, IPBlockListStrict, IPBlockListLoose, CSV, JSON, XML}
+
 var log = new(Log)
+var apiCache *Cache
+var apiURL = ApiUrl
 
 type Agent struct {
 	// Imported from input JSON
@@ -54,13 +72,20 @@ type Agent struct {
 	IPAddresses       []string `json:"ipAddresses"`
 	PublicIPAddresses []string `json:"publicIpAddresses"`
 	ClusterMembers    []Agent  `json:"clusterMembers"`
+	AgentState        string   `json:"agentState"`
+	Enabled           *bool    `json:"enabled"`
+	Labels            []Label  `json:"labels"`
+	AgentVersion      string   `json:"agentVersion"`
+	Network           string   `json:"network"`
+	LastSeen          string   `json:"lastSeen"`
 	// Generated
-	IPv4Addresses     []net.IP
-	IPv6Addresses     []net.IP
-	IPv4SubnetsStrict []net.IPNet
-	IPv6SubnetsStrict []net.IPNet
-	IPv4SubnetsLoose  []net.IPNet
-	IPv6SubnetsLoose  []net.IPNet
+	AccountGroupIDs   []string
+	IPv4Addresses     []netip.Addr
+	IPv6Addresses     []netip.Addr
+	IPv4SubnetsStrict []netip.Prefix
+	IPv6SubnetsStrict []netip.Prefix
+	IPv4SubnetsLoose  []netip.Prefix
+	IPv6SubnetsLoose  []netip.Prefix
 	IPv4RangesStrict  []IPRange
 	IPv6RangesStrict  []IPRange
 	IPv4RangesLoose   []IPRange
@@ -75,28 +100,98 @@ func main() {
 
 	// Flags
 	version := flag.Bool("v", false, "Prints out version")
-	ags := flag.Bool("account-groups", false, "Prints out Account Group IDs")
-	output := flag.String("o", SubnetListStrict, "Output type ("+IPList+", "+SubnetListStrict+", "+SubnetListLoose+", "+IPRangeListStrict+", "+IPRangeListLoose+", "+IPBlockListStrict+", "+IPBlockListLoose+", "+CSV+", "+JSON+", "+XML+")")
+	ags := flag.Bool("account-groups", false, "Prints out Account Group IDs, use -o "+CSV+", "+JSON+", "+XML+" or "+YAML+" for machine-readable output")
+	org := flag.String("org", "", "Display only Account Groups in provided organizations with -account-groups or -aid all (i.e. \"Acme,Acme Labs\")")
+	output := flag.String("o", SubnetListStrict, "Output type ("+IPList+", "+SubnetListStrict+", "+SubnetListLoose+", "+SubnetListOptimal+", "+IPRangeListStrict+", "+IPRangeListLoose+", "+IPBlockListStrict+", "+IPBlockListLoose+", "+CSV+", "+JSON+", "+XML+")")
 	token := flag.String("t", "", "ThousandEyes API token")
-	aid := flag.String("aid", "default", "Display Agents available in chosen Account Group ID")
+	tokenFile := flag.String("token-file", "", "Read ThousandEyes API token from file")
+	tokenStdin := flag.Bool("token-stdin", false, "Read ThousandEyes API token from standard input")
+	aid := flag.String("aid", "default", "Display Agents available in chosen Account Group IDs (i.e. \"123,456\"), or \"all\" for all Account Groups")
 	i4 := flag.Bool("4", false, "Display only IPv4 addresses")
 	i6 := flag.Bool("6", false, "Display only IPv6 addresses")
 	ea := flag.Bool("e", false, "Display only Enterprise Agent addresses")
 	ca := flag.Bool("c", false, "Display only Cloud Agent addresses")
 	eaPub := flag.Bool("e-public", false, "Display only Enterprise Agent Public IP addresses")
 	eaPriv := flag.Bool("e-private", false, "Display only Enterprise Agent Private IP addresses")
-	name := flag.Bool("n", false, "Add Agent name as a comment to "+IPList+", "+SubnetListStrict+", "+SubnetListLoose+", "+IPRangeListStrict+", "+IPRangeListLoose+", "+IPBlockListStrict+" and "+IPBlockListLoose+" output types.")
-	country := flag.String("country", "", "Display only agents in provided countries (i.e. \"US,SI,DE\")")
-	flag.Parse()
+	name := flag.Bool("n", false, "Add Agent name as a comment to "+IPList+", "+SubnetListStrict+", "+SubnetListLoose+", "+SubnetListOptimal+", "+IPRangeListStrict+", "+IPRangeListLoose+", "+IPBlockListStrict+" and "+IPBlockListLoose+" output types.")
+	region := flag.String("region", "", "Display only agents in provided regions ("+strings.Join(Regions, ", ")+")")
+	continent := flag.String("continent", "", "Display only agents in provided continents ("+strings.Join(Continents, ", ")+")")
+	groupBy := flag.String("group-by", "", "Write a section, or a file with -out containing "+GroupPlaceholder+", per group of Agents ("+strings.Join(GroupByTypes, ", ")+", or a combination i.e. \"type,country\")")
+	splitBy := flag.String("split-by", "", "Write a file per group of Agents to -out-dir ("+strings.Join(GroupByTypes, ", ")+", or a combination i.e. \"type,country\")")
+	outDir := flag.String("out-dir", "", "Directory where -split-by writes files and the "+ManifestFileName+" manifest")
+	country := flag.String("country", "", "Display only agents in provided countries, or not in countries prefixed with ! (i.e. \"US,SI,DE\" or \"!CN,!RU\")")
+	excludeCountry := flag.String("exclude-country", "", "Do not display agents in provided countries (i.e. \"CN,RU\")")
+	onlineOnly := flag.Bool("online-only", false, "Display only Agents that are online, and only online members of Enterprise Agent Clusters")
+	enabledOnly := flag.Bool("enabled-only", false, "Display only enabled Agents")
+	var labels LabelListFlag
+	flag.Var(&labels, "label", "Display only Agents with provided label, can be repeated to require all")
+	var agentIDs, excludeAgentIDs IDListFlag
+	var agentNameRegexps, locationRegexps RegexpListFlag
+	flag.Var(&agentIDs, "agent-id", "Display only Agents with provided IDs (i.e. \"123,456\"), can be repeated")
+	flag.Var(&excludeAgentIDs, "exclude-agent-id", "Do not display Agents with provided IDs (i.e. \"123,456\"), can be repeated")
+	flag.Var(&agentNameRegexps, "agent-name-regex", "Display only Agents with name matching provided regular expression, can be repeated to match all")
+	flag.Var(&locationRegexps, "location-regex", "Display only Agents with location matching provided regular expression, can be repeated to match all")
+	var testIDs IDListFlag
+	var testNameRegexps RegexpListFlag
+	flag.Var(&testIDs, "test-id", "Display only Agents assigned to tests with provided IDs (i.e. \"111,222\"), can be repeated")
+	flag.Var(&testNameRegexps, "test-name-regex", "Display only Agents assigned to tests with name matching provided regular expression, can be repeated to match all")
+	exclude := flag.String("exclude", "", "Remove Agent IPs in provided subnets or IP addresses and never cover them with loose output types or -max-entries (i.e. \"10.0.0.0/8,192.0.2.1\")")
+	excludeFile := flag.String("exclude-file", "", "Read subnets or IP addresses to exclude from file, one or more per line")
+	include := flag.String("include", "", "Add provided subnets or IP addresses to Agent IPs (i.e. \"198.51.100.0/30,192.0.2.1\")")
+	includeFile := flag.String("include-file", "", "Read subnets or IP addresses to include from file, one or more per line")
+	includeName := flag.String("include-name", "Custom", "Agent name of included subnets and IP addresses")
+	minPrefixV4 := flag.Int("min-prefix-v4", DefaultLooseOptions.MinPrefixV4, "Widest IPv4 prefix length used by loose output types")
+	minPrefixV6 := flag.Int("min-prefix-v6", DefaultLooseOptions.MinPrefixV6, "Widest IPv6 prefix length used by loose output types")
+	maxGap := flag.Int("max-gap", DefaultLooseOptions.MaxGap, "Average number of addresses between Agent IPs joined in a range by "+IPRangeListLoose+" output type")
+	maxOvercoverRatio := flag.Float64("max-overcover-ratio", DefaultLooseOptions.MaxOvercoverRatio, "Largest ratio of addresses not used by Agents in a subnet, range or block created by loose output types (0-1)")
+	maxEntries := flag.Int("max-entries", 0, "Merge subnets or ranges until output has at most provided number of entries, admitting as few addresses not used by Agents as possible")
+	reportCoverage := flag.Bool("report-coverage", false, "Print number of Agent IPs and addresses covered by each subnet, range or block to standard error, in addition to the list")
+	field := flag.Int("field", 0, "Whitespace separated field of log lines holding the source IP annotated by annotate, starting with 1")
+	fieldRegex := flag.String("field-regex", "", "Regular expression whose first capture group holds the source IP annotated by annotate")
+	out := flag.String("out", "", "Write output to file instead of standard output, replaced atomically and only if its content changed")
+	onChange := flag.String("on-change", "", "Command run with the system shell when -out or -out-dir files change (i.e. \"nginx -s reload\")")
+	profile := flag.String("profile", "", "Load flags from named profile in configuration file")
+	config := flag.String("config", defaultConfigPath(), "Configuration file with profiles")
+	cacheDir := flag.String("cache-dir", "", "Cache API responses in provided directory, responses are not cached if not provided")
+	cacheTTL := flag.Duration("cache-ttl", 5*time.Minute, "Time cached API responses are used without revalidation")
+	noCache := flag.Bool("no-cache", false, "Do not read or write cached API responses")
+	refresh := flag.Bool("refresh", false, "Revalidate cached API responses regardless of -cache-ttl")
+	apiURLFlag := flag.String("api-url", ApiUrl, "ThousandEyes API URL, i.e. of a mock API used in tests")
+
+	// Subcommand is the first argument, its flags and files follow it
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == Convert || args[0] == Lookup || args[0] == Annotate) {
+		command = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	if *profile != "" {
+		err := applyProfile(*config, *profile)
+		if err != nil {
+			log.Error("Unable to load profile '%s': %s", *profile, err.Error())
+			os.Exit(0)
+		}
+	}
 
 	if *version == true {
 		fmt.Printf("\nThousandEyes Agent IP List v%s (%s/%s)\n\n", Ver, runtime.GOOS, runtime.GOARCH)
 		os.Exit(0)
 	}
 
-	if *token == "" {
+	var err error
+	if command != Convert {
+		*token, err = resolveToken(*token, *tokenFile, *tokenStdin)
+		if err != nil {
+			log.Error("Unable to read ThousandEyes API token: %s", err.Error())
+			os.Exit(0)
+		}
+	}
+
+	if *token == "" && command != Convert {
 		fmt.Printf("\nThousandEyes Agent IP List v%s (%s/%s)\n\n", Ver, runtime.GOOS, runtime.GOARCH)
-		fmt.Printf("Usage:\n  %s -t <api-bearer-token>\n\nHelp:\n", os.Args[0])
+		fmt.Printf("Usage:\n  %s -t <api-bearer-token>\n  %s %s [flags] [file ...]\n  %s %s [flags] [ip|file ...]\n  %s %s [flags] [file ...]\n\nThe token can also be provided with -token-file, -token-stdin or the %s environment variable.\n\nHelp:\n", os.Args[0], os.Args[0], Convert, os.Args[0], Lookup, os.Args[0], Annotate, TokenEnvVar)
 		flag.PrintDefaults()
 		fmt.Printf("\n")
 		os.Exit(0)
@@ -134,68 +229,398 @@ func main() {
 		enterprisePrivate = true
 	}
 
-	if *aid != Default {
-		if _, err := strconv.Atoi(*aid); err != nil {
-			log.Error("%a is not a valid -aid value, it must be a number. Try '-account-groups' to list the available Account Group IDs.", *aid)
-			os.Exit(0)
+	// Account Groups listed more than once are fetched once
+	aids := uniqueList(strings.Split(*aid, ","))
+	if *aid != Default && *aid != All && command != Convert {
+		for _, a := range aids {
+			if _, err := strconv.Atoi(a); err != nil {
+				log.Error("%s is not a valid -aid value, it must be a number. Try '-account-groups' to list the available Account Group IDs.", a)
+				os.Exit(0)
+			}
 		}
 	}
 
-	if !validateBearerToken(*token) {
-		log.Error("'%s' is not a valid ThousandEyes API Bearer token. Find your token at https://app.thousandeyes.com/settings/account/?section=profile", *token)
+	if !validateBearerToken(*token) && command != Convert {
+		log.Error("Provided token (%d characters) is not a valid ThousandEyes API Bearer token. Find your token at https://app.thousandeyes.com/settings/account/?section=profile", len(*token))
 		os.Exit(0)
 	}
 
-	if *ags == true {
-		err := outputAccountGroups(*token)
+	apiURL = strings.TrimSuffix(*apiURLFlag, "/")
+	if !*noCache && *cacheDir != "" {
+		apiCache = &Cache{Dir: *cacheDir, TTL: *cacheTTL, Refresh: *refresh}
+	}
+
+	if *onChange != "" && *out == "" && *outDir == "" {
+		log.Error("-on-change requires -out or -out-dir")
+		os.Exit(0)
+	}
+
+	// Output file is replaced only once all output is written, and only if its
+	// content changed
+	var w io.Writer = os.Stdout
+	var outFile *AtomicFile
+	if *out != "" && !strings.Contains(*out, GroupPlaceholder) {
+		outFile = &AtomicFile{Path: *out}
+		w = outFile
+	}
+	done := func(changed bool) {
+		if outFile != nil {
+			fileChanged, err := outFile.Commit()
+			if err != nil {
+				log.Error("Unable to write output file: %s", err.Error())
+				os.Exit(0)
+			}
+			changed = changed || fileChanged
+		}
+		if changed && *onChange != "" {
+			if err := runCommand(*onChange); err != nil {
+				log.Error("-on-change command failed: %s", err.Error())
+			}
+		}
+		os.Exit(0)
+	}
+
+	if *ags == true && command != Convert {
+		accountGroups, err := fetchAccountGroups(*token)
 		if err != nil {
 			log.Error("/v7/account-groups API call error: %s", err.Error())
+			os.Exit(0)
+		}
+		if *org != "" {
+			accountGroups = filterAccountGroupsByOrganization(accountGroups, strings.Split(*org, ","))
+		}
+		if strings.ToLower(*output) == CSV {
+			outputAccountGroupsCSV(w, accountGroups)
+		} else if strings.ToLower(*output) == JSON {
+			outputAccountGroupsJSON(w, accountGroups)
+		} else if strings.ToLower(*output) == XML {
+			outputAccountGroupsXML(w, accountGroups)
+		} else if strings.ToLower(*output) == YAML {
+			outputAccountGroupsYAML(w, accountGroups)
+		} else {
+			outputAccountGroups(w, accountGroups)
 		}
+		done(false)
+	}
+
+	regions := splitList(*region)
+	for _, r := range regions {
+		if !containsFold(Regions, r) {
+			log.Error("-region '%s' not supported. Supported regions: %s", r, strings.Join(Regions, ", "))
+			os.Exit(0)
+		}
+	}
+	continents := splitList(*continent)
+	for _, c := range continents {
+		if !containsFold(Continents, c) {
+			log.Error("-continent '%s' not supported. Supported continents: %s", c, strings.Join(Continents, ", "))
+			os.Exit(0)
+		}
+	}
+	countries, excludeCountries := parseCountries(append(splitList(*country), prefixList(splitList(*excludeCountry), "!")...))
+
+	if *aid == All && command != Convert {
+		accountGroups, err := fetchAccountGroups(*token)
+		if err != nil {
+			log.Error("/v7/account-groups API call error: %s", err.Error())
+			os.Exit(0)
+		}
+		if *org != "" {
+			accountGroups = filterAccountGroupsByOrganization(accountGroups, strings.Split(*org, ","))
+		}
+		aids = []string{}
+		for _, a := range accountGroups {
+			aids = append(aids, strconv.Itoa(a.ID))
+		}
+	}
+
+	excludeNets, err := parseIPNets(strings.Split(*exclude, ","))
+	if err != nil {
+		log.Error("Invalid -exclude: %s", err.Error())
 		os.Exit(0)
 	}
+	if *excludeFile != "" {
+		fileNets, err := readIPNetsFile(*excludeFile)
+		if err != nil {
+			log.Error("Unable to read -exclude-file: %s", err.Error())
+			os.Exit(0)
+		}
+		excludeNets = append(excludeNets, fileNets...)
+	}
 
-	countries := strings.Split(*country, ",")
-	if len(countries) == 1 {
-		if countries[0] == "" {
-			countries = []string{}
-		}
-	}
-
-	agents, _ := fetchAgents(*token, *aid, enterprise, cloud, ipv4, ipv6, enterprisePublic, enterprisePrivate, countries)
-
-	if strings.ToLower(*output) == IPList {
-		outputIPList(agents, *name)
-	} else if strings.ToLower(*output) == SubnetListStrict {
-		outputSubnetListStrict(agents, *name)
-	} else if strings.ToLower(*output) == SubnetListLoose {
-		outputSubnetListLoose(agents, *name)
-	} else if strings.ToLower(*output) == IPRangeListStrict {
-		outputIPRangeListStrict(agents, *name)
-	} else if strings.ToLower(*output) == IPRangeListLoose {
-		outputIPRangeListLoose(agents, *name)
-	} else if strings.ToLower(*output) == IPBlockListStrict {
-		outputIPBlockListStrict(agents, *name)
-	} else if strings.ToLower(*output) == IPBlockListLoose {
-		outputIPBlockListLoose(agents, *name)
-	} else if strings.ToLower(*output) == CSV {
-		outputCSV(agents)
-	} else if strings.ToLower(*output) == JSON {
-		outputJSON(agents)
-	} else if strings.ToLower(*output) == XML {
-		outputXML(agents)
-	} else {
-		log.Error("Output type '%s' not supported. Supported output types: %s, %s, %s, %s, %s, %s, %s", *output, IPList, SubnetListStrict, SubnetListLoose, IPRangeListStrict, CSV, JSON, XML)
+	includeNets, err := parseIPNets(strings.Split(*include, ","))
+	if err != nil {
+		log.Error("Invalid -include: %s", err.Error())
+		os.Exit(0)
+	}
+	if *includeFile != "" {
+		fileNets, err := readIPNetsFile(*includeFile)
+		if err != nil {
+			log.Error("Unable to read -include-file: %s", err.Error())
+			os.Exit(0)
+		}
+		includeNets = append(includeNets, fileNets...)
+	}
+	customAgent, err := includeAgent(includeNets, *includeName, ipv4, ipv6)
+	if err != nil {
+		log.Error("%s", err.Error())
+		os.Exit(0)
+	}
+
+	looseOptions := LooseOptions{MinPrefixV4: *minPrefixV4, MinPrefixV6: *minPrefixV6, MaxGap: *maxGap, MaxOvercoverRatio: *maxOvercoverRatio, Exclude: excludeNets}
+	if err := looseOptions.Validate(); err != nil {
+		log.Error("%s", err.Error())
+		os.Exit(0)
+	}
+
+	if !slices.Contains(OutputTypes, strings.ToLower(*output)) {
+		log.Error("Output type '%s' not supported. Supported output types: %s", *output, strings.Join(OutputTypes, ", "))
+		os.Exit(0)
+	}
+	groupByTypes, err := parseGroupBy(*groupBy)
+	if err != nil {
+		log.Error("-group-by %s", err.Error())
+		os.Exit(0)
+	}
+	splitByTypes, err := parseGroupBy(*splitBy)
+	if err != nil {
+		log.Error("-split-by %s", err.Error())
 		os.Exit(0)
 	}
+	if (len(splitByTypes) > 0) != (*outDir != "") {
+		log.Error("-split-by and -out-dir must be used together")
+		os.Exit(0)
+	} else if len(splitByTypes) > 0 && (len(groupByTypes) > 0 || *out != "") {
+		log.Error("-split-by can not be combined with -group-by or -out")
+		os.Exit(0)
+	}
+	if len(groupByTypes) > 0 {
+		o := strings.ToLower(*output)
+		if (o == CSV || o == JSON || o == XML) && !strings.Contains(*out, GroupPlaceholder) {
+			log.Error("-group-by with %s, %s and %s output types requires -out with %s in the file name", CSV, JSON, XML, GroupPlaceholder)
+			os.Exit(0)
+		}
+	} else if strings.Contains(*out, GroupPlaceholder) {
+		log.Error("-out with %s in the file name requires -group-by", GroupPlaceholder)
+		os.Exit(0)
+	}
+	if *maxEntries > 0 {
+		o := strings.ToLower(*output)
+		if o != SubnetListStrict && o != SubnetListLoose && o != SubnetListOptimal && o != IPRangeListStrict && o != IPRangeListLoose {
+			log.Error("-max-entries is supported only with %s, %s, %s, %s and %s output types", SubnetListStrict, SubnetListLoose, SubnetListOptimal, IPRangeListStrict, IPRangeListLoose)
+			os.Exit(0)
+		}
+	}
+
+	var fieldRe *regexp.Regexp
+	if *fieldRegex != "" {
+		fieldRe, err = regexp.Compile(*fieldRegex)
+		if err != nil {
+			log.Error("Invalid -field-regex: %s", err.Error())
+			os.Exit(0)
+		}
+	}
+	if *reportCoverage {
+		o := strings.ToLower(*output)
+		if o == IPList || o == CSV || o == JSON || o == XML {
+			log.Error("-report-coverage is supported only with subnet, range and block output types")
+			os.Exit(0)
+		}
+	}
+
+	var agents []Agent
+	if command == Convert {
+		agents, err = convertAgents(flag.Args(), ipv4, ipv6)
+		if err != nil {
+			log.Error("Unable to read list: %s", err.Error())
+			os.Exit(0)
+		}
+	} else {
+		agentFilter := AgentFilter{AgentIDs: agentIDs, ExcludeAgentIDs: excludeAgentIDs, NameRegexps: agentNameRegexps, LocationRegexps: locationRegexps,
+			OnlineOnly: *onlineOnly, EnabledOnly: *enabledOnly, Labels: labels,
+			Regions: regions, Continents: continents, Countries: countries, ExcludeCountries: excludeCountries}
+		if len(testIDs) > 0 || len(testNameRegexps) > 0 {
+			agentFilter.TestAgentIDs, err = fetchTestAgentIDs(*token, aids, testIDs, testNameRegexps)
+			if err != nil {
+				log.Error("Unable to filter Agents by tests: %s", err.Error())
+				os.Exit(0)
+			}
+		}
+		agents, err = fetchAgents(*token, aids, enterprise, cloud, ipv4, ipv6, enterprisePublic, enterprisePrivate, agentFilter)
+		if err != nil {
+			log.Error("/v7/agents API call error: %s", err.Error())
+			os.Exit(0)
+		}
+		if len(agents) == 0 {
+			log.Warn("No Agents match provided filters")
+		}
+	}
+	if len(customAgent.IPv4Addresses) > 0 || len(customAgent.IPv6Addresses) > 0 {
+		agents = append(agents, customAgent)
+	}
+	agents = excludeAgentIPs(agents, excludeNets)
+
+	explicitFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
+	listOptions := ListOptions{Name: *name, MaxEntries: *maxEntries, Loose: looseOptions, Budget: looseOptions.BudgetOptions(explicitFlags), AccountGroups: *aid != Default && command != Convert}
+	if *reportCoverage {
+		// Report must not end up in the list written to standard output or -out
+		listOptions.Coverage = os.Stderr
+	}
+	if command == Lookup {
+		ips, err := lookupIPs(flag.Args())
+		if err != nil {
+			log.Error("Unable to read IP addresses to look up: %s", err.Error())
+			os.Exit(0)
+		}
+		if err := outputLookup(w, newAgentIndex(agents), ips, *output, listOptions); err != nil {
+			log.Error("%s", err.Error())
+			os.Exit(0)
+		}
+		done(false)
+	}
+	if command == Annotate {
+		annotateOptions := AnnotateOptions{Field: *field, Regex: fieldRe, JSON: strings.ToLower(*output) == JSON}
+		if err := annotateFiles(w, flag.Args(), newAgentIndex(agents), annotateOptions); err != nil {
+			// Non-zero exit status, so pipelines notice a full disk or broken pipe
+			log.Error("Unable to annotate log: %s", err.Error())
+			os.Exit(1)
+		}
+		done(false)
+	}
+
+	if len(splitByTypes) > 0 {
+		changed, err := splitOutput(*outDir, agents, splitByTypes, *output, listOptions)
+		if err != nil {
+			log.Error("Unable to write -out-dir: %s", err.Error())
+			os.Exit(0)
+		}
+		done(changed)
+	}
+	if len(groupByTypes) > 0 {
+		groups := groupAgents(agents, groupByTypes)
+		if !strings.Contains(*out, GroupPlaceholder) {
+			outputGroups(w, groups, *output, listOptions)
+			done(false)
+		}
+		changed := false
+		for _, group := range groups {
+			path := strings.ReplaceAll(*out, GroupPlaceholder, group.Name)
+			f := &AtomicFile{Path: path}
+			outputAgents(f, group.Agents, *output, listOptions)
+			fileChanged, err := f.Commit()
+			if err != nil {
+				log.Error("Unable to write output file: %s", err.Error())
+				os.Exit(0)
+			}
+			changed = changed || fileChanged
+		}
+		done(changed)
+	}
+	outputAgents(w, agents, *output, listOptions)
+	done(false)
 
 }
 
+// Writes Agent IPs in the output type, validated with OutputTypes
+func outputAgents(w io.Writer, agents []Agent, output string, opts ListOptions) {
+
+	index := newAgentIndex(agents)
+
+	if strings.ToLower(output) == IPList {
+		outputIPList(w, index, opts)
+	} else if strings.ToLower(output) == SubnetListStrict {
+		outputSubnetListStrict(w, index, opts)
+	} else if strings.ToLower(output) == SubnetListLoose {
+		outputSubnetListLoose(w, index, opts)
+	} else if strings.ToLower(output) == SubnetListOptimal {
+		outputSubnetListOptimal(w, index, opts)
+	} else if strings.ToLower(output) == IPRangeListStrict {
+		outputIPRangeListStrict(w, index, opts)
+	} else if strings.ToLower(output) == IPRangeListLoose {
+		outputIPRangeListLoose(w, index, opts)
+	} else if strings.ToLower(output) == IPBlockListStrict {
+		outputIPBlockListStrict(w, index, opts)
+	} else if strings.ToLower(output) == IPBlockListLoose {
+		outputIPBlockListLoose(w, index, opts)
+	} else if strings.ToLower(output) == CSV {
+		outputCSV(w, agents, opts)
+	} else if strings.ToLower(output) == JSON {
+		outputJSON(w, agents, opts.Loose)
+	} else if strings.ToLower(output) == XML {
+		outputXML(w, agents, opts.Loose)
+	}
+
+}
+
+// Returns the API token from the first source provided, in order of precedence:
+// -t, -token-file, -token-stdin and TE_TOKEN environment variable
+func resolveToken(token, tokenFile string, tokenStdin bool) (string, error) {
+
+	if token != "" {
+		return token, nil
+	}
+
+	if tokenFile != "" {
+		b, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if tokenStdin {
+		line, err := readLine(os.Stdin)
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	return strings.TrimSpace(os.Getenv(TokenEnvVar)), nil
+
+}
+
+// Reads one line byte by byte, so input after it is left on r for the lookup
+// and annotate subcommands
+func readLine(r io.Reader) (string, error) {
+	line := []byte{}
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
+
 func validateBearerToken(token string) bool {
 	Re := regexp.MustCompile(`^[a-zA-Z0-9-]{36,64}$`)
 	return Re.MatchString(token)
 }
 
-func apiRequest(token, endpoint string) *http.Response {
+// Returns API response, served from apiCache when enabled
+func apiRequest(token, endpoint string) (*http.Response, error) {
+
+	if apiCache == nil {
+		return apiHTTPRequest(token, endpoint, "")
+	}
+
+	return apiCache.Request(token, endpoint)
+
+}
+
+// Sends API request. When etag is provided, the request is conditional and the
+// API may respond with 304 Not Modified.
+func apiHTTPRequest(token, endpoint, etag string) (*http.Response, error) {
 
 	var netTransport = &http.Transport{
 		Dial: (&net.Dialer{
@@ -209,49 +634,52 @@ func apiRequest(token, endpoint string) *http.Response {
 		Transport: netTransport,
 	}
 
-	request, _ := http.NewRequest("GET", ApiUrl+endpoint, nil)
+	request, _ := http.NewRequest("GET", apiURL+endpoint, nil)
 	request.Header.Set("Authorization", "Bearer "+token)
 	request.Header.Set("User-Agent", "te-iplist/"+Ver)
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
 	response, err := netClient.Do(request)
 	if err != nil {
-		log.Error("TE API request error: %s", err.Error())
-		os.Exit(0)
+		return nil, fmt.Errorf("TE API request error: %s", err.Error())
 	}
 
 	if response.StatusCode == http.StatusOK {
 		// yupepeeee
-	} else if response.StatusCode == http.StatusUnauthorized {
-		log.Error("Invalid credentials provided. (401)")
-		os.Exit(0)
+		return response, nil
+	} else if response.StatusCode == http.StatusNotModified && etag != "" {
+		// Cached response is still valid
+		return response, nil
+	}
+
+	response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		err = errors.New("Invalid credentials provided. (401)")
 	} else if response.StatusCode == http.StatusForbidden {
-		log.Error("Your account does not have permissions to view Agents for this Account Group. (403)")
-		os.Exit(0)
+		err = errors.New("Your account does not have permissions to view Agents for this Account Group. (403)")
 	} else if response.StatusCode == http.StatusTooManyRequests {
-		log.Error("Your are issuing to many API calls. Try again in a minute. (429)")
-		os.Exit(0)
+		err = errors.New("Your are issuing to many API calls. Try again in a minute. (429)")
 	} else if response.StatusCode == http.StatusInternalServerError {
-		log.Error("ThousandEyes API internal server error. Try again later. (500)")
-		os.Exit(0)
+		err = errors.New("ThousandEyes API internal server error. Try again later. (500)")
 	} else if response.StatusCode == http.StatusServiceUnavailable {
-		log.Error("ThousandEyes API is under maintenance. Try again later. (503)")
-		os.Exit(0)
+		err = errors.New("ThousandEyes API is under maintenance. Try again later. (503)")
 	} else {
-		log.Error("ThousandEyes API HTTP error: %s", response.Status)
-		os.Exit(0)
+		err = fmt.Errorf("ThousandEyes API HTTP error: %s", response.Status)
 	}
 
-	return response
+	return nil, err
 
 }
 
-func outputAccountGroups(token string) error {
+type AccountGroup struct {
+	ID               int    `json:"aid,string"`
+	Name             string `json:"accountGroupName"`
+	OrganizationName string `json:"organizationName"`
+	Default          bool   `json:"isDefaultAccountGroup"`
+}
 
-	type AccountGroup struct {
-		ID               int    `json:"aid,string"`
-		Name             string `json:"accountGroupName"`
-		OrganizationName string `json:"organizationName"`
-		Default          bool   `json:"isDefaultAccountGroup"`
-	}
+func fetchAccountGroups(token string) ([]AccountGroup, error) {
 
 	type AccountGroups struct {
 		AccountGroups []AccountGroup `json:"accountGroups"`
@@ -259,17 +687,44 @@ func outputAccountGroups(token string) error {
 
 	var accountGroups AccountGroups
 
-	response := apiRequest(token, "/v7/account-groups")
+	response, err := apiRequest(token, "/v7/account-groups")
+	if err != nil {
+		return []AccountGroup{}, err
+	}
+	defer response.Body.Close()
 
-	err := json.NewDecoder(response.Body).Decode(&accountGroups)
+	err = json.NewDecoder(response.Body).Decode(&accountGroups)
 	if err != nil {
-		return err
+		return []AccountGroup{}, err
+	}
+
+	return accountGroups.AccountGroups, nil
+
+}
+
+// Returns Account Groups that belong to one of the provided organizations
+func filterAccountGroupsByOrganization(accountGroups []AccountGroup, organizations []string) []AccountGroup {
+
+	returnAccountGroups := []AccountGroup{}
+	for _, a := range accountGroups {
+		for _, o := range organizations {
+			if strings.EqualFold(a.OrganizationName, strings.TrimSpace(o)) {
+				returnAccountGroups = append(returnAccountGroups, a)
+				break
+			}
+		}
 	}
 
+	return returnAccountGroups
+
+}
+
+func outputAccountGroups(w io.Writer, accountGroups []AccountGroup) {
+
 	maxIdLen := 3
 	maxNameLen := 18
 	maxOrgLen := 17
-	for _, a := range accountGroups.AccountGroups {
+	for _, a := range accountGroups {
 		idStr := strconv.Itoa(a.ID)
 		if len(idStr) > maxIdLen {
 			maxIdLen = len(idStr)
@@ -282,20 +737,85 @@ func outputAccountGroups(token string) error {
 		}
 	}
 
-	fmt.Printf("\n%s  %s  %s\n", pad("AID", maxIdLen), pad("Organization Name", maxOrgLen), pad("Account Group Name", maxNameLen))
-	for _, a := range accountGroups.AccountGroups {
-		fmt.Printf("\n%s  %s  %s", pad(strconv.Itoa(a.ID), maxIdLen), pad(a.OrganizationName, maxOrgLen), pad(a.Name, maxNameLen))
+	fmt.Fprintf(w, "\n%s  %s  %s\n", pad("AID", maxIdLen), pad("Organization Name", maxOrgLen), pad("Account Group Name", maxNameLen))
+	for _, a := range accountGroups {
+		fmt.Fprintf(w, "\n%s  %s  %s", pad(strconv.Itoa(a.ID), maxIdLen), pad(a.OrganizationName, maxOrgLen), pad(a.Name, maxNameLen))
 		if a.Default {
-			fmt.Printf(" (default)")
+			fmt.Fprintf(w, " (default)")
 		}
 	}
-	fmt.Printf("\n\n")
+	fmt.Fprintf(w, "\n\n")
+
+}
 
-	return nil
+func outputAccountGroupsCSV(w io.Writer, accountGroups []AccountGroup) {
+
+	fmt.Fprintf(w, "AID%sOrganization Name%sAccount Group Name%sDefault\n", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
+	for _, a := range accountGroups {
+		// Quotes in names are doubled, as CSV escapes them
+		fmt.Fprintf(w, "%s%s\"%s\"%s\"%s\"%s%t\n", strconv.Itoa(a.ID), CSVSeparatorChar, strings.ReplaceAll(a.OrganizationName, "\"", "\"\""), CSVSeparatorChar, strings.ReplaceAll(a.Name, "\"", "\"\""), CSVSeparatorChar, a.Default)
+	}
 
 }
 
-func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePublic, enterprisePrivate bool, countries []string) ([]Agent, error) {
+func outputAccountGroupsJSON(w io.Writer, accountGroups []AccountGroup) {
+
+	type OutputAccountGroup struct {
+		ID               int    `json:"aid"`
+		Name             string `json:"accountGroupName"`
+		OrganizationName string `json:"organizationName"`
+		Default          bool   `json:"isDefaultAccountGroup"`
+	}
+
+	outputAccountGroups := []OutputAccountGroup{}
+	for _, a := range accountGroups {
+		outputAccountGroups = append(outputAccountGroups, OutputAccountGroup(a))
+	}
+
+	j, _ := json.MarshalIndent(outputAccountGroups, "", "  ")
+
+	fmt.Fprintf(w, "%s", string(j))
+}
+
+func outputAccountGroupsXML(w io.Writer, accountGroups []AccountGroup) {
+
+	type OutputAccountGroup struct {
+		XMLName          xml.Name `xml:"accountGroup"`
+		ID               int      `xml:"aid"`
+		Name             string   `xml:"accountGroupName"`
+		OrganizationName string   `xml:"organizationName"`
+		Default          bool     `xml:"isDefaultAccountGroup"`
+	}
+
+	outputAccountGroups := []OutputAccountGroup{}
+	for _, a := range accountGroups {
+		outputAccountGroups = append(outputAccountGroups, OutputAccountGroup{ID: a.ID, Name: a.Name, OrganizationName: a.OrganizationName, Default: a.Default})
+	}
+
+	x, _ := xml.MarshalIndent(outputAccountGroups, "", "  ")
+
+	fmt.Fprintf(w, "%s", xml.Header)
+	fmt.Fprintf(w, "%s", string(x))
+}
+
+func outputAccountGroupsYAML(w io.Writer, accountGroups []AccountGroup) {
+
+	if len(accountGroups) == 0 {
+		fmt.Fprintf(w, "[]\n")
+		return
+	}
+
+	for _, a := range accountGroups {
+		fmt.Fprintf(w, "- aid: %d\n", a.ID)
+		fmt.Fprintf(w, "  accountGroupName: %s\n", strconv.Quote(a.Name))
+		fmt.Fprintf(w, "  organizationName: %s\n", strconv.Quote(a.OrganizationName))
+		fmt.Fprintf(w, "  isDefaultAccountGroup: %t\n", a.Default)
+	}
+
+}
+
+// Fetches Agents available in a single Account Group
+func fetchAccountGroupAgents(token, aid string) ([]Agent, error) {
 
 	type Agents struct {
 		Agents []Agent `json:"agents"`
@@ -308,13 +828,79 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		endpoint = endpoint + "&aid=" + aid
 	}
 
-	response := apiRequest(token, endpoint)
+	response, err := apiRequest(token, endpoint)
+	if err != nil {
+		return []Agent{}, err
+	}
+	defer response.Body.Close()
 
-	err := json.NewDecoder(response.Body).Decode(&agents)
+	err = json.NewDecoder(response.Body).Decode(&agents)
 	if err != nil {
 		return []Agent{}, err
 	}
 
+	if aid != Default {
+		for i := range agents.Agents {
+			agents.Agents[i].AccountGroupIDs = []string{aid}
+		}
+	}
+
+	return agents.Agents, nil
+
+}
+
+// Calls fetch with every index from 0 to n-1, at most MaxConcurrentRequests at
+// a time, and returns when all calls are done
+func fetchConcurrently(n int, fetch func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(MaxConcurrentRequests, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fetch(i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func fetchAgents(token string, aids []string, enterprise, cloud, ipv4, ipv6, enterprisePublic, enterprisePrivate bool, filter AgentFilter) ([]Agent, error) {
+
+	type Agents struct {
+		Agents []Agent `json:"agents"`
+	}
+
+	var agents Agents
+
+	// Fetch Account Groups concurrently
+	results := make([][]Agent, len(aids))
+	errs := make([]error, len(aids))
+	fetchConcurrently(len(aids), func(i int) {
+		results[i], errs[i] = fetchAccountGroupAgents(token, aids[i])
+	})
+
+	// Agents available in multiple Account Groups are listed once
+	agentIndex := map[int]int{}
+	for i, result := range results {
+		if errs[i] != nil {
+			return []Agent{}, fmt.Errorf("Account Group %s: %s", aids[i], errs[i].Error())
+		}
+		for _, agent := range result {
+			if n, ok := agentIndex[agent.AgentID]; ok {
+				agents.Agents[n].AccountGroupIDs = append(agents.Agents[n].AccountGroupIDs, agent.AccountGroupIDs...)
+			} else {
+				agentIndex[agent.AgentID] = len(agents.Agents)
+				agents.Agents = append(agents.Agents, agent)
+			}
+		}
+	}
+
 	if !enterprise || !cloud {
 		for i := len(agents.Agents) - 1; i >= 0; i-- {
 			agent := agents.Agents[i]
@@ -336,9 +922,9 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 				// ThousandEyes API is returning both IPv4 and IPv6 addresses for Cloud agents that only
 				// use one IP version for tests. Until this is changed (IDEA-5589), we filter out unused IPs
 				if ipv6 && strings.Contains(ip, ":") && strings.Contains(agent.AgentName, "IPv6") {
-					agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 				} else if ipv4 && strings.Contains(ip, ".") && !strings.Contains(agent.AgentName, "IPv6") {
-					agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 				}
 			}
 		}
@@ -346,9 +932,9 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		if (agent.AgentType == Enterprise && enterprisePrivate) && len(agent.IPAddresses) > 0 {
 			for _, ip := range agent.IPAddresses {
 				if ipv6 && strings.Contains(ip, ":") {
-					agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 				} else if ipv4 && strings.Contains(ip, ".") {
-					agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 				}
 			}
 		}
@@ -356,17 +942,20 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		if enterprisePublic && len(agent.PublicIPAddresses) > 0 {
 			for _, ip := range agent.PublicIPAddresses {
 				if ipv6 && strings.Contains(ip, ":") {
-					agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 				} else if ipv4 && strings.Contains(ip, ".") {
-					agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+					agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 				}
 			}
 			for _, clusterMember := range agent.ClusterMembers {
+				if filter.OnlineOnly && !clusterMember.Online() {
+					continue
+				}
 				for _, ip := range clusterMember.PublicIPAddresses {
 					if ipv6 && strings.Contains(ip, ":") {
-						agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 					} else if ipv4 && strings.Contains(ip, ".") {
-						agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 					}
 				}
 			}
@@ -374,11 +963,14 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		// Enterprise Cluster private addresses
 		if enterprisePrivate && agent.AgentType == EnterpriseCluster && len(agent.ClusterMembers) > 0 {
 			for _, clusterMember := range agent.ClusterMembers {
+				if filter.OnlineOnly && !clusterMember.Online() {
+					continue
+				}
 				for _, ip := range clusterMember.IPAddresses {
 					if ipv6 && strings.Contains(ip, ":") {
-						agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 					} else if ipv4 && strings.Contains(ip, ".") {
-						agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 					}
 				}
 			}
@@ -386,11 +978,14 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		// Enterprise Cluster public addresses
 		if enterprisePublic && agent.AgentType == EnterpriseCluster && len(agent.ClusterMembers) > 0 {
 			for _, clusterMember := range agent.ClusterMembers {
+				if filter.OnlineOnly && !clusterMember.Online() {
+					continue
+				}
 				for _, ip := range clusterMember.PublicIPAddresses {
 					if ipv6 && strings.Contains(ip, ":") {
-						agents.Agents[i].IPv6Addresses = append(agents.Agents[i].IPv6Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv6Addresses = appendAddr(agents.Agents[i].IPv6Addresses, ip)
 					} else if ipv4 && strings.Contains(ip, ".") {
-						agents.Agents[i].IPv4Addresses = append(agents.Agents[i].IPv4Addresses, net.ParseIP(ip))
+						agents.Agents[i].IPv4Addresses = appendAddr(agents.Agents[i].IPv4Addresses, ip)
 					}
 				}
 			}
@@ -413,27 +1008,37 @@ func fetchAgents(token, aid string, enterprise, cloud, ipv4, ipv6, enterprisePub
 		}
 	}
 
-	if len(countries) > 0 {
-		for i := len(agents.Agents) - 1; i >= 0; i-- {
-			// Condition to decide if current element has to be deleted:
-			if slices.Contains(countries, agents.Agents[i].CountryID) {
-				// Keep it
-			} else {
-				agents.Agents = append(agents.Agents[:i], agents.Agents[i+1:]...)
-			}
+	for i := len(agents.Agents) - 1; i >= 0; i-- {
+		if !filter.Match(agents.Agents[i]) {
+			agents.Agents = append(agents.Agents[:i], agents.Agents[i+1:]...)
 		}
 	}
 
 	return agents.Agents, nil
 }
 
-func outputIPList(agents []Agent, name bool) {
+// Options of list output types
+type ListOptions struct {
+	Name       bool
+	MaxEntries int
+	// Coverage report of subnet, range and block lists is written to Coverage
+	// in addition to the list, nil if it is not reported
+	Coverage io.Writer
+	Loose    LooseOptions
+	// Limits of -max-entries merges, see LooseOptions.BudgetOptions
+	Budget LooseOptions
+	// Account Group IDs column is added to CSV output, only when explicit or
+	// multiple Account Groups are fetched, so default CSV output is unchanged
+	AccountGroups bool
+}
+
+func outputIPList(w io.Writer, index *AgentIndex, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
+	ips := index.IPs()
 
 	for _, ip := range ips {
-		if name {
-			agentsWithIP := getAgentsByIP(agents, ip)
+		if opts.Name {
+			agentsWithIP := index.ByIP(ip)
 			agentsStr := ""
 			for _, agent := range agentsWithIP {
 				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
@@ -441,55 +1046,44 @@ func outputIPList(agents []Agent, name bool) {
 			if len(agentsStr) > 1 {
 				agentsStr = agentsStr[2:]
 			}
-			fmt.Printf("%s %s %s\n", pad(ip.String(), 39), ListCommentChar, agentsStr)
+			fmt.Fprintf(w, "%s %s %s\n", pad(ip.String(), 39), ListCommentChar, agentsStr)
 		} else {
-			fmt.Printf("%s\n", ip.String())
+			fmt.Fprintf(w, "%s\n", ip.String())
 		}
 	}
 
 }
 
-func outputSubnetListStrict(agents []Agent, name bool) {
+func outputSubnetListStrict(w io.Writer, index *AgentIndex, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
-	ipNets := ipsToSubnetsStrict(ips)
+	ips := index.IPs()
+	outputSubnetList(w, index, ips, budgetSubnets(ips, ipsToSubnetsStrict(ips), opts.MaxEntries, opts.Budget), opts)
 
-	for _, ipNet := range ipNets {
-		s, t := ipNet.Mask.Size()
-		if name {
-			agentsWithIP := getAgentsBySubnet(agents, ipNet)
-			agentsStr := ""
-			for _, agent := range agentsWithIP {
-				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
-			}
-			if len(agentsStr) > 1 {
-				agentsStr = agentsStr[2:]
-			}
-			if s == t {
-				fmt.Printf("%s %s %s\n", pad(ipNet.IP.String(), 39), ListCommentChar, agentsStr)
-			} else {
-				fmt.Printf("%s %s %s\n", pad(ipNet.String(), 39), ListCommentChar, agentsStr)
-			}
-		} else {
-			if s == t {
-				fmt.Printf("%s\n", ipNet.IP.String())
-			} else {
-				fmt.Printf("%s\n", ipNet.String())
-			}
-		}
-	}
+}
+
+func outputSubnetListLoose(w io.Writer, index *AgentIndex, opts ListOptions) {
+
+	ips := index.IPs()
+	outputSubnetList(w, index, ips, budgetSubnets(ips, ipsToSubnetsLoose(ips, opts.Loose), opts.MaxEntries, opts.Budget), opts)
 
 }
 
-func outputSubnetListLoose(agents []Agent, name bool) {
+func outputSubnetListOptimal(w io.Writer, index *AgentIndex, opts ListOptions) {
+
+	ips := index.IPs()
+	outputSubnetList(w, index, ips, budgetSubnets(ips, ipsToSubnetsOptimal(ips), opts.MaxEntries, opts.Budget), opts)
+
+}
 
-	ips := sortAgentIPs(agents)
-	ipNets := ipsToSubnetsLoose(ips)
+func outputSubnetList(w io.Writer, index *AgentIndex, ips []netip.Addr, ipNets []netip.Prefix, opts ListOptions) {
+
+	if opts.Coverage != nil {
+		outputCoverageReport(opts.Coverage, subnetsCoverage(ips, ipNets))
+	}
 
 	for _, ipNet := range ipNets {
-		s, t := ipNet.Mask.Size()
-		if name {
-			agentsWithIP := getAgentsBySubnet(agents, ipNet)
+		if opts.Name {
+			agentsWithIP := index.BySubnet(ipNet)
 			agentsStr := ""
 			for _, agent := range agentsWithIP {
 				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
@@ -497,16 +1091,16 @@ func outputSubnetListLoose(agents []Agent, name bool) {
 			if len(agentsStr) > 1 {
 				agentsStr = agentsStr[2:]
 			}
-			if s == t {
-				fmt.Printf("%s %s %s\n", pad(ipNet.IP.String(), 39), ListCommentChar, agentsStr)
+			if ipNet.IsSingleIP() {
+				fmt.Fprintf(w, "%s %s %s\n", pad(ipNet.Addr().String(), 39), ListCommentChar, agentsStr)
 			} else {
-				fmt.Printf("%s %s %s\n", pad(ipNet.String(), 39), ListCommentChar, agentsStr)
+				fmt.Fprintf(w, "%s %s %s\n", pad(ipNet.String(), 39), ListCommentChar, agentsStr)
 			}
 		} else {
-			if s == t {
-				fmt.Printf("%s\n", ipNet.IP.String())
+			if ipNet.IsSingleIP() {
+				fmt.Fprintf(w, "%s\n", ipNet.Addr().String())
 			} else {
-				fmt.Printf("%s\n", ipNet.String())
+				fmt.Fprintf(w, "%s\n", ipNet.String())
 			}
 		}
 	}
@@ -514,72 +1108,44 @@ func outputSubnetListLoose(agents []Agent, name bool) {
 }
 
 type IPRange struct {
-	StartIP net.IP
-	EndIP   net.IP
+	StartIP netip.Addr
+	EndIP   netip.Addr
 }
 
-func (ipRange IPRange) Contains(ip net.IP) bool {
-	if ip.To4() != nil && ipRange.StartIP.To4() != nil && ipRange.EndIP.To4() != nil {
-		// IPv4
-		if binary.BigEndian.Uint32(ip.To4()) >= binary.BigEndian.Uint32(ipRange.StartIP.To4()) && binary.BigEndian.Uint32(ip.To4()) <= binary.BigEndian.Uint32(ipRange.EndIP.To4()) {
-			return true
-		}
-	} else if ip.To4() == nil && ipRange.StartIP.To4() == nil && ipRange.EndIP.To4() == nil {
-		// IPv6
-		if binary.BigEndian.Uint64(ip[0:8]) > binary.BigEndian.Uint64(ipRange.StartIP[0:8]) && binary.BigEndian.Uint64(ip[0:8]) < binary.BigEndian.Uint64(ipRange.EndIP[0:8]) {
-			return true
-		} else if bytes.Compare(ip[0:8], ipRange.StartIP[0:8]) == 0 && binary.BigEndian.Uint64(ip[0:8]) < binary.BigEndian.Uint64(ipRange.EndIP[0:8]) &&
-			binary.BigEndian.Uint64(ip[8:16]) >= binary.BigEndian.Uint64(ipRange.StartIP[8:16]) {
-			return true
-		} else if binary.BigEndian.Uint64(ip[0:8]) > binary.BigEndian.Uint64(ipRange.StartIP[0:8]) && bytes.Compare(ip[0:8], ipRange.EndIP[0:8]) == 0 &&
-			binary.BigEndian.Uint64(ip[8:16]) <= binary.BigEndian.Uint64(ipRange.EndIP[8:16]) {
-			return true
-		} else if bytes.Compare(ip[0:8], ipRange.StartIP[0:8]) == 0 && bytes.Compare(ip[0:8], ipRange.EndIP[0:8]) == 0 &&
-			binary.BigEndian.Uint64(ip[8:16]) >= binary.BigEndian.Uint64(ipRange.StartIP[8:16]) && binary.BigEndian.Uint64(ip[8:16]) <= binary.BigEndian.Uint64(ipRange.EndIP[8:16]) {
-			return true
-		}
-	}
-	return false
+func (ipRange IPRange) Contains(ip netip.Addr) bool {
+	return ip.Is4() == ipRange.StartIP.Is4() && ipRange.StartIP.Compare(ip) <= 0 && ip.Compare(ipRange.EndIP) <= 0
 }
 func (ipRange IPRange) String() string {
-	if bytes.Compare(ipRange.StartIP, ipRange.EndIP) != 0 {
+	if ipRange.StartIP != ipRange.EndIP {
 		return ipRange.StartIP.String() + " - " + ipRange.EndIP.String()
 	} else {
 		return ipRange.StartIP.String()
 	}
 }
 
-func outputIPRangeListStrict(agents []Agent, name bool) {
+func outputIPRangeListStrict(w io.Writer, index *AgentIndex, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
-	ipRanges := ipsToIPRangesStrict(ips)
+	ips := index.IPs()
+	outputIPRangeList(w, index, ips, budgetIPRanges(ips, ipsToIPRangesStrict(ips), opts.MaxEntries, opts.Budget), opts)
 
-	for _, ipRange := range ipRanges {
-		if name {
-			agentsWithIP := getAgentsByIPRange(agents, ipRange)
-			agentsStr := ""
-			for _, agent := range agentsWithIP {
-				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
-			}
-			if len(agentsStr) > 1 {
-				agentsStr = agentsStr[2:]
-			}
-			fmt.Printf("%s %s %s\n", pad(ipRange.String(), 59), ListCommentChar, agentsStr)
-		} else {
-			fmt.Printf("%s\n", ipRange.String())
-		}
-	}
+}
+
+func outputIPRangeListLoose(w io.Writer, index *AgentIndex, opts ListOptions) {
+
+	ips := index.IPs()
+	outputIPRangeList(w, index, ips, budgetIPRanges(ips, ipsToIPRangesLoose(ips, opts.Loose), opts.MaxEntries, opts.Budget), opts)
 
 }
 
-func outputIPRangeListLoose(agents []Agent, name bool) {
+func outputIPRangeList(w io.Writer, index *AgentIndex, ips []netip.Addr, ipRanges []IPRange, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
-	ipRanges := ipsToIPRangesLoose(ips)
+	if opts.Coverage != nil {
+		outputCoverageReport(opts.Coverage, ipRangesCoverage(ips, ipRanges))
+	}
 
 	for _, ipRange := range ipRanges {
-		if name {
-			agentsWithIP := getAgentsByIPRange(agents, ipRange)
+		if opts.Name {
+			agentsWithIP := index.ByIPRange(ipRange)
 			agentsStr := ""
 			for _, agent := range agentsWithIP {
 				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
@@ -587,46 +1153,48 @@ func outputIPRangeListLoose(agents []Agent, name bool) {
 			if len(agentsStr) > 1 {
 				agentsStr = agentsStr[2:]
 			}
-			fmt.Printf("%s %s %s\n", pad(ipRange.String(), 59), ListCommentChar, agentsStr)
+			fmt.Fprintf(w, "%s %s %s\n", pad(ipRange.String(), 59), ListCommentChar, agentsStr)
 		} else {
-			fmt.Printf("%s\n", ipRange.String())
+			fmt.Fprintf(w, "%s\n", ipRange.String())
 		}
 	}
 
 }
 
 type IPBlock struct {
-	StartIP net.IP
-	EndIP   net.IP
+	StartIP netip.Addr
+	EndIP   netip.Addr
+}
+
+// Returns addresses of an IPv4 block whose C part is a range and D part is
+// equal, i.e. 10.0.[1-2].20, and false for blocks where the D part or the last
+// IPv6 hextet is a range, which are the same as an IPRange
+func (ipBlock IPBlock) cRangeIPs() ([]netip.Addr, bool) {
+	if !ipBlock.StartIP.Is4() || !ipBlock.EndIP.Is4() {
+		return nil, false
+	}
+	start4, end4 := ipBlock.StartIP.As4(), ipBlock.EndIP.As4()
+	if start4[2] == end4[2] {
+		return nil, false
+	}
+	ips := []netip.Addr{}
+	for c := int(start4[2]); c <= int(end4[2]); c++ {
+		ips = append(ips, netip.AddrFrom4([4]byte{start4[0], start4[1], byte(c), start4[3]}))
+	}
+	return ips, true
 }
 
-func (ipBlock IPBlock) Contains(ip net.IP) bool {
-	if ip.To4() != nil && ipBlock.StartIP.To4() != nil && ipBlock.EndIP.To4() != nil {
-		if binary.BigEndian.Uint32(ip.To4()) >= binary.BigEndian.Uint32(ipBlock.StartIP.To4()) && binary.BigEndian.Uint32(ip.To4()) <= binary.BigEndian.Uint32(ipBlock.EndIP.To4()) {
-			return true
-		}
-	} else if ip.To4() == nil && ipBlock.StartIP.To4() == nil && ipBlock.EndIP.To4() == nil {
-		if binary.BigEndian.Uint64(ip[0:8]) > binary.BigEndian.Uint64(ipBlock.StartIP[0:8]) && binary.BigEndian.Uint64(ip[0:8]) < binary.BigEndian.Uint64(ipBlock.EndIP[0:8]) {
-			return true
-		} else if bytes.Compare(ip[0:8], ipBlock.StartIP[0:8]) == 0 && binary.BigEndian.Uint64(ip[0:8]) < binary.BigEndian.Uint64(ipBlock.EndIP[0:8]) &&
-			binary.BigEndian.Uint64(ip[8:16]) >= binary.BigEndian.Uint64(ipBlock.StartIP[8:16]) {
-			return true
-		} else if binary.BigEndian.Uint64(ip[0:8]) > binary.BigEndian.Uint64(ipBlock.StartIP[0:8]) && bytes.Compare(ip[0:8], ipBlock.EndIP[0:8]) == 0 &&
-			binary.BigEndian.Uint64(ip[8:16]) <= binary.BigEndian.Uint64(ipBlock.EndIP[8:16]) {
-			return true
-		} else if bytes.Compare(ip[0:8], ipBlock.StartIP[0:8]) == 0 && bytes.Compare(ip[0:8], ipBlock.EndIP[0:8]) == 0 &&
-			binary.BigEndian.Uint64(ip[8:16]) >= binary.BigEndian.Uint64(ipBlock.StartIP[8:16]) && binary.BigEndian.Uint64(ip[8:16]) <= binary.BigEndian.Uint64(ipBlock.EndIP[8:16]) {
-			return true
-		}
-	}
-	return false
+func (ipBlock IPBlock) Contains(ip netip.Addr) bool {
+	if ips, ok := ipBlock.cRangeIPs(); ok {
+		return slices.Contains(ips, ip)
+	}
+	return IPRange(ipBlock).Contains(ip)
 }
 func (ipBlock IPBlock) String() string {
-	start4 := ipBlock.StartIP.To4()
-	end4 := ipBlock.EndIP.To4()
-	if start4 != nil && end4 != nil {
+	if ipBlock.StartIP.Is4() && ipBlock.EndIP.Is4() {
 		// IPv4
-		if bytes.Compare(ipBlock.StartIP, ipBlock.EndIP) == 0 {
+		start4, end4 := ipBlock.StartIP.As4(), ipBlock.EndIP.As4()
+		if ipBlock.StartIP == ipBlock.EndIP {
 			return ipBlock.StartIP.String()
 		} else if start4[3] != end4[3] {
 			return strconv.Itoa(int(start4[0])) + "." + strconv.Itoa(int(start4[1])) + "." + strconv.Itoa(int(start4[2])) + ".[" + strconv.Itoa(int(start4[3])) + "-" + strconv.Itoa(int(end4[3])) + "]"
@@ -634,83 +1202,40 @@ func (ipBlock IPBlock) String() string {
 			return strconv.Itoa(int(start4[0])) + "." + strconv.Itoa(int(start4[1])) + ".[" + strconv.Itoa(int(start4[2])) + "-" + strconv.Itoa(int(end4[2])) + "]." + strconv.Itoa(int(start4[3]))
 		}
 	} else {
-		// IPv6
-		if bytes.Compare(ipBlock.StartIP, ipBlock.EndIP) == 0 {
+		// IPv6, only the last hextet differs, i.e. 2001:db8::[5-7]
+		if ipBlock.StartIP == ipBlock.EndIP {
 			return ipBlock.StartIP.String()
 		} else {
-			var firstStr, startStr, endStr string
-			var firstLen int
-			for b := 0; b <= 14; b = b + 2 {
-				if bytes.Compare(ipBlock.StartIP[:b+2], ipBlock.EndIP[:b+2]) == 0 {
-					firstStr = fmt.Sprintf("%s%x", firstStr, binary.BigEndian.Uint16(ipBlock.StartIP[b:b+2])) + ":"
-					firstLen = b + 2
-				} else {
-					startStr = fmt.Sprintf("%s%x", startStr, binary.BigEndian.Uint16(ipBlock.StartIP[b:b+2])) + ":"
-					endStr = fmt.Sprintf("%s%x", endStr, binary.BigEndian.Uint16(ipBlock.EndIP[b:b+2])) + ":"
-				}
-			}
-			startStr = startStr[:len(startStr)-1]
-			endStr = endStr[:len(endStr)-1]
-
-			// Shorten IPv6
-			if !strings.Contains(firstStr, "::") {
-				// Go will shorten IP, lets just generate a complete IP
-				fakePrefix := ""
-				for i := 0; i*2 < firstLen; i++ {
-					fakePrefix = fmt.Sprintf("%s%x:", fakePrefix, i+1)
-				}
-				fakeStartIPStr := fakePrefix + startStr
-				fakeEndIPStr := fakePrefix + endStr
-				fakeStartIP := net.ParseIP(fakeStartIPStr)
-				fakeEndIP := net.ParseIP(fakeEndIPStr)
-				fakeStartIPStr = fakeStartIP.String()
-				fakeEndIPStr = fakeEndIP.String()
-				startStr = fakeStartIPStr[len(fakePrefix):]
-				endStr = fakeEndIPStr[len(fakePrefix):]
-			}
-			if len(startStr) > 1 && len(endStr) > 1 && startStr[0:1] == ":" && endStr[0:1] == ":" && startStr[0:2] != "::" && endStr[0:2] != "::" {
-				return firstStr + ":[" + startStr[1:] + "-" + endStr[1:] + "]"
-			} else if startStr[:1] == ":" || endStr[:1] == ":" {
-				return firstStr[:len(firstStr)-1] + "[:" + startStr + "-:" + endStr + "]"
-			} else {
-				return firstStr + "[" + startStr + "-" + endStr + "]"
-			}
+			startStr := ipBlock.StartIP.String()
+			return fmt.Sprintf("%s[%x-%x]", startStr[:strings.LastIndex(startStr, ":")+1], uint128FromAddr(ipBlock.StartIP).lo&0xffff, uint128FromAddr(ipBlock.EndIP).lo&0xffff)
 		}
 	}
 	return ipBlock.StartIP.String()
 }
 
-func outputIPBlockListStrict(agents []Agent, name bool) {
+func outputIPBlockListStrict(w io.Writer, index *AgentIndex, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
-	ipBlocks := ipsToIPBlocksStrict(ips)
+	ips := index.IPs()
+	outputIPBlockList(w, index, ips, ipsToIPBlocksStrict(ips), opts)
 
-	for _, ipBlock := range ipBlocks {
-		if name {
-			agentsWithIP := getAgentsByIPBlock(agents, ipBlock)
-			agentsStr := ""
-			for _, agent := range agentsWithIP {
-				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
-			}
-			if len(agentsStr) > 1 {
-				agentsStr = agentsStr[2:]
-			}
-			fmt.Printf("%s %s %s\n", pad(ipBlock.String(), 46), ListCommentChar, agentsStr)
-		} else {
-			fmt.Printf("%s\n", pad(ipBlock.String(), 46))
-		}
-	}
+}
+
+func outputIPBlockListLoose(w io.Writer, index *AgentIndex, opts ListOptions) {
+
+	ips := index.IPs()
+	outputIPBlockList(w, index, ips, ipsToIPBlocksLoose(ips, opts.Loose), opts)
 
 }
 
-func outputIPBlockListLoose(agents []Agent, name bool) {
+func outputIPBlockList(w io.Writer, index *AgentIndex, ips []netip.Addr, ipBlocks []IPBlock, opts ListOptions) {
 
-	ips := sortAgentIPs(agents)
-	ipBlocks := ipsToIPBlocksLoose(ips)
+	if opts.Coverage != nil {
+		outputCoverageReport(opts.Coverage, ipBlocksCoverage(ips, ipBlocks))
+	}
 
 	for _, ipBlock := range ipBlocks {
-		if name {
-			agentsWithIP := getAgentsByIPBlock(agents, ipBlock)
+		if opts.Name {
+			agentsWithIP := index.ByIPBlock(ipBlock)
 			agentsStr := ""
 			for _, agent := range agentsWithIP {
 				agentsStr = agentsStr + ListSeparatorChar + " " + agent.AgentName
@@ -718,24 +1243,28 @@ func outputIPBlockListLoose(agents []Agent, name bool) {
 			if len(agentsStr) > 1 {
 				agentsStr = agentsStr[2:]
 			}
-			fmt.Printf("%s %s %s\n", pad(ipBlock.String(), 46), ListCommentChar, agentsStr)
+			fmt.Fprintf(w, "%s %s %s\n", pad(ipBlock.String(), 46), ListCommentChar, agentsStr)
 		} else {
-			fmt.Printf("%s\n", pad(ipBlock.String(), 46))
+			fmt.Fprintf(w, "%s\n", pad(ipBlock.String(), 46))
 		}
 	}
 
 }
 
-func outputCSV(agents []Agent) {
+func outputCSV(w io.Writer, agents []Agent, opts ListOptions) {
 
-	fmt.Printf("Agent ID%sAgent Name%sAgent Type%sLocation%sCountry%s", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
-	fmt.Printf("IPv4 Addresses%sIPv4 Subnets (Strict)%sIPv4 Subnets (Loose)%sIPv4 Ranges (Strict)%sIPv4 Ranges (Loose)%sIPv4 Blocks (Strict)%sIPv4 Blocks (Loose)%s", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
-	fmt.Printf("IPv6 Addresses%sIPv6 Subnets (Strict)%sIPv6 Subnets (Loose)%sIPv6 Ranges (Strict)%sIPv6 Ranges (Loose)%sIPv6 Blocks (Strict)%sIPv6 Blocks (Loose)\n", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
+	fmt.Fprintf(w, "Agent ID%sAgent Name%sAgent Type%sLocation%sCountry%s", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
+	fmt.Fprintf(w, "IPv4 Addresses%sIPv4 Subnets (Strict)%sIPv4 Subnets (Loose)%sIPv4 Ranges (Strict)%sIPv4 Ranges (Loose)%sIPv4 Blocks (Strict)%sIPv4 Blocks (Loose)%s", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
+	fmt.Fprintf(w, "IPv6 Addresses%sIPv6 Subnets (Strict)%sIPv6 Subnets (Loose)%sIPv6 Ranges (Strict)%sIPv6 Ranges (Loose)%sIPv6 Blocks (Strict)%sIPv6 Blocks (Loose)", CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar, CSVSeparatorChar)
+	if opts.AccountGroups {
+		fmt.Fprintf(w, "%sAccount Group IDs", CSVSeparatorChar)
+	}
+	fmt.Fprintf(w, "\n")
 
-	agents = addDataToAgents(agents)
+	agents = addDataToAgents(agents, opts.Loose)
 
 	for _, agent := range agents {
-		fmt.Printf("%s%s\"%s\"%s%s%s\"%s\"%s%s%s", strconv.Itoa(agent.AgentID), CSVSeparatorChar, agent.AgentName, CSVSeparatorChar, agent.AgentType, CSVSeparatorChar, agent.Location, CSVSeparatorChar, agent.CountryID, CSVSeparatorChar)
+		fmt.Fprintf(w, "%s%s\"%s\"%s%s%s\"%s\"%s%s%s", strconv.Itoa(agent.AgentID), CSVSeparatorChar, agent.AgentName, CSVSeparatorChar, agent.AgentType, CSVSeparatorChar, agent.Location, CSVSeparatorChar, agent.CountryID, CSVSeparatorChar)
 
 		ipStr := ""
 		if len(agent.IPv4Addresses) > 0 {
@@ -744,33 +1273,31 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					ipStr = ipStr + ipNet.IP.String() + "\n"
+				if ipNet.IsSingleIP() {
+					ipStr = ipStr + ipNet.Addr().String() + "\n"
 				} else {
 					ipStr = ipStr + ipNet.String() + "\n"
 				}
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					ipStr = ipStr + ipNet.IP.String() + "\n"
+				if ipNet.IsSingleIP() {
+					ipStr = ipStr + ipNet.Addr().String() + "\n"
 				} else {
 					ipStr = ipStr + ipNet.String() + "\n"
 				}
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4RangesStrict) > 0 {
 			for _, ipRange := range agent.IPv4RangesStrict {
@@ -778,7 +1305,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4RangesLoose) > 0 {
 			for _, ipRange := range agent.IPv4RangesLoose {
@@ -786,7 +1313,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4BlocksStrict) > 0 {
 			for _, ipBlock := range agent.IPv4BlocksStrict {
@@ -794,7 +1321,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv4BlocksLoose) > 0 {
 			for _, ipBlock := range agent.IPv4BlocksLoose {
@@ -802,7 +1329,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6Addresses) > 0 {
 			for _, ip := range agent.IPv6Addresses {
@@ -810,33 +1337,31 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					ipStr = ipStr + ipNet.IP.String() + "\n"
+				if ipNet.IsSingleIP() {
+					ipStr = ipStr + ipNet.Addr().String() + "\n"
 				} else {
 					ipStr = ipStr + ipNet.String() + "\n"
 				}
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					ipStr = ipStr + ipNet.IP.String() + "\n"
+				if ipNet.IsSingleIP() {
+					ipStr = ipStr + ipNet.Addr().String() + "\n"
 				} else {
 					ipStr = ipStr + ipNet.String() + "\n"
 				}
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6RangesStrict) > 0 {
 			for _, ipRange := range agent.IPv6RangesStrict {
@@ -844,7 +1369,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6RangesLoose) > 0 {
 			for _, ipRange := range agent.IPv6RangesLoose {
@@ -852,7 +1377,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6BlocksStrict) > 0 {
 			for _, ipBlock := range agent.IPv6BlocksStrict {
@@ -860,7 +1385,7 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"%s", ipStr, CSVSeparatorChar)
+		fmt.Fprintf(w, "\"%s\"%s", ipStr, CSVSeparatorChar)
 		ipStr = ""
 		if len(agent.IPv6BlocksLoose) > 0 {
 			for _, ipBlock := range agent.IPv6BlocksLoose {
@@ -868,14 +1393,17 @@ func outputCSV(agents []Agent) {
 			}
 			ipStr = ipStr[0 : len(ipStr)-1]
 		}
-		fmt.Printf("\"%s\"", ipStr)
+		fmt.Fprintf(w, "\"%s\"", ipStr)
+		if opts.AccountGroups {
+			fmt.Fprintf(w, "%s\"%s\"", CSVSeparatorChar, strings.Join(agent.AccountGroupIDs, "\n"))
+		}
 
-		fmt.Printf("\n")
+		fmt.Fprintf(w, "\n")
 	}
 
 }
 
-func outputJSON(agents []Agent) {
+func outputJSON(w io.Writer, agents []Agent, opts LooseOptions) {
 
 	type OutputAgent struct {
 		AgentID           int      `json:"agentId"`
@@ -883,6 +1411,7 @@ func outputJSON(agents []Agent) {
 		AgentType         string   `json:"agentType"`
 		Location          string   `json:"location"`
 		CountryID         string   `json:"countryId"`
+		AccountGroupIDs   []string `json:"accountGroupId,omitempty"`
 		IPv4Addresses     []string `json:"ipv4Address,omitempty"`
 		IPv6Addresses     []string `json:"ipv6Address,omitempty"`
 		IPv4SubnetsStrict []string `json:"ipv4SubnetStrict,omitempty"`
@@ -900,10 +1429,10 @@ func outputJSON(agents []Agent) {
 	}
 
 	outputAgents := []OutputAgent{}
-	agents = addDataToAgents(agents)
+	agents = addDataToAgents(agents, opts)
 
 	for _, agent := range agents {
-		outputAgent := OutputAgent{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType, Location: agent.Location, CountryID: agent.CountryID}
+		outputAgent := OutputAgent{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType, Location: agent.Location, CountryID: agent.CountryID, AccountGroupIDs: agent.AccountGroupIDs}
 		if len(agent.IPv4Addresses) > 0 {
 			for _, ip := range agent.IPv4Addresses {
 				outputAgent.IPv4Addresses = append(outputAgent.IPv4Addresses, ip.String())
@@ -916,9 +1445,8 @@ func outputJSON(agents []Agent) {
 		}
 		if len(agent.IPv4SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.String())
 				}
@@ -926,9 +1454,8 @@ func outputJSON(agents []Agent) {
 		}
 		if len(agent.IPv6SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.String())
 				}
@@ -936,9 +1463,8 @@ func outputJSON(agents []Agent) {
 		}
 		if len(agent.IPv4SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.String())
 				}
@@ -946,9 +1472,8 @@ func outputJSON(agents []Agent) {
 		}
 		if len(agent.IPv6SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.String())
 				}
@@ -999,18 +1524,19 @@ func outputJSON(agents []Agent) {
 
 	j, _ := json.MarshalIndent(outputAgents, "", "  ")
 
-	fmt.Printf("%s", string(j))
+	fmt.Fprintf(w, "%s", string(j))
 }
 
-func outputXML(agents []Agent) {
+func outputXML(w io.Writer, agents []Agent, opts LooseOptions) {
 
 	type OutputAgent struct {
 		XMLName           xml.Name `xml:"agent"`
 		AgentID           int      `xml:"agentId"`
 		AgentName         string   `xml:"agentName"`
 		AgentType         string   `xml:"agentType"`
-		Location          string   `xml:"location,omitempty""`
-		CountryID         string   `xml:"countryId,omitempty""`
+		Location          string   `xml:"location,omitempty"`
+		CountryID         string   `xml:"countryId,omitempty"`
+		AccountGroupIDs   []string `xml:"accountGroupId,omitempty"`
 		IPv4Addresses     []string `xml:"ipv4Address,omitempty"`
 		IPv6Addresses     []string `xml:"ipv6Address,omitempty"`
 		IPv4SubnetsStrict []string `xml:"ipv4SubnetStrict,omitempty"`
@@ -1028,10 +1554,10 @@ func outputXML(agents []Agent) {
 	}
 
 	outputAgents := []OutputAgent{}
-	agents = addDataToAgents(agents)
+	agents = addDataToAgents(agents, opts)
 
 	for _, agent := range agents {
-		outputAgent := OutputAgent{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType, Location: agent.Location, CountryID: agent.CountryID}
+		outputAgent := OutputAgent{AgentID: agent.AgentID, AgentName: agent.AgentName, AgentType: agent.AgentType, Location: agent.Location, CountryID: agent.CountryID, AccountGroupIDs: agent.AccountGroupIDs}
 		if len(agent.IPv4Addresses) > 0 {
 			for _, ip := range agent.IPv4Addresses {
 				outputAgent.IPv4Addresses = append(outputAgent.IPv4Addresses, ip.String())
@@ -1044,9 +1570,8 @@ func outputXML(agents []Agent) {
 		}
 		if len(agent.IPv4SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv4SubnetsStrict = append(outputAgent.IPv4SubnetsStrict, ipNet.String())
 				}
@@ -1054,9 +1579,8 @@ func outputXML(agents []Agent) {
 		}
 		if len(agent.IPv6SubnetsStrict) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsStrict {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv6SubnetsStrict = append(outputAgent.IPv6SubnetsStrict, ipNet.String())
 				}
@@ -1064,9 +1588,8 @@ func outputXML(agents []Agent) {
 		}
 		if len(agent.IPv4SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv4SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv4SubnetsLoose = append(outputAgent.IPv4SubnetsLoose, ipNet.String())
 				}
@@ -1074,9 +1597,8 @@ func outputXML(agents []Agent) {
 		}
 		if len(agent.IPv6SubnetsLoose) > 0 {
 			for _, ipNet := range agent.IPv6SubnetsLoose {
-				s, t := ipNet.Mask.Size()
-				if s == t {
-					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.IP.String())
+				if ipNet.IsSingleIP() {
+					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.Addr().String())
 				} else {
 					outputAgent.IPv6SubnetsLoose = append(outputAgent.IPv6SubnetsLoose, ipNet.String())
 				}
@@ -1127,57 +1649,30 @@ func outputXML(agents []Agent) {
 
 	x, _ := xml.MarshalIndent(outputAgents, "", "  ")
 
-	fmt.Printf("%s", xml.Header)
-	fmt.Printf("%s", string(x))
-}
-
-// Sort agent IPs, IPv4 first, IPv6 following
-func sortAgentIPs(agents []Agent) []net.IP {
-
-	ipv4IPs := []net.IP{}
-	for _, agent := range agents {
-		if len(agent.IPv4Addresses) > 0 {
-			for _, ip := range agent.IPv4Addresses {
-				ipv4IPs = append(ipv4IPs, ip)
-			}
-		}
-	}
-	ipv4IPs = sortIPs(ipv4IPs)
-
-	ipv6IPs := []net.IP{}
-	for _, agent := range agents {
-		if len(agent.IPv6Addresses) > 0 {
-			for _, ip := range agent.IPv6Addresses {
-				ipv6IPs = append(ipv6IPs, ip)
-			}
-		}
-	}
-	ipv6IPs = sortIPs(ipv6IPs)
-
-	return append(ipv4IPs, ipv6IPs...)
-
+	fmt.Fprintf(w, "%s", xml.Header)
+	fmt.Fprintf(w, "%s", string(x))
 }
 
-func addDataToAgents(agents []Agent) []Agent {
+func addDataToAgents(agents []Agent, opts LooseOptions) []Agent {
 
 	for i, agent := range agents {
 		if len(agent.IPv4Addresses) > 0 {
 			ips := sortIPs(agent.IPv4Addresses)
 			agents[i].IPv4SubnetsStrict = ipsToSubnetsStrict(ips)
-			agents[i].IPv4SubnetsLoose = ipsToSubnetsLoose(ips)
+			agents[i].IPv4SubnetsLoose = ipsToSubnetsLoose(ips, opts)
 			agents[i].IPv4RangesStrict = ipsToIPRangesStrict(ips)
-			agents[i].IPv4RangesLoose = ipsToIPRangesLoose(ips)
+			agents[i].IPv4RangesLoose = ipsToIPRangesLoose(ips, opts)
 			agents[i].IPv4BlocksStrict = ipsToIPBlocksStrict(ips)
-			agents[i].IPv4BlocksLoose = ipsToIPBlocksLoose(ips)
+			agents[i].IPv4BlocksLoose = ipsToIPBlocksLoose(ips, opts)
 		}
 		if len(agent.IPv6Addresses) > 0 {
 			ips := sortIPs(agent.IPv6Addresses)
 			agents[i].IPv6SubnetsStrict = ipsToSubnetsStrict(ips)
-			agents[i].IPv6SubnetsLoose = ipsToSubnetsLoose(ips)
+			agents[i].IPv6SubnetsLoose = ipsToSubnetsLoose(ips, opts)
 			agents[i].IPv6RangesStrict = ipsToIPRangesStrict(ips)
-			agents[i].IPv6RangesLoose = ipsToIPRangesLoose(ips)
+			agents[i].IPv6RangesLoose = ipsToIPRangesLoose(ips, opts)
 			agents[i].IPv6BlocksStrict = ipsToIPBlocksStrict(ips)
-			agents[i].IPv6BlocksLoose = ipsToIPBlocksLoose(ips)
+			agents[i].IPv6BlocksLoose = ipsToIPBlocksLoose(ips, opts)
 		}
 	}
 
@@ -1186,13 +1681,13 @@ func addDataToAgents(agents []Agent) []Agent {
 }
 
 // Sort the list of IPs numerically
-func sortIPs(ips []net.IP) []net.IP {
+func sortIPs(ips []netip.Addr) []netip.Addr {
 
-	sort.Stable(IPSlice(ips))
+	slices.SortStableFunc(ips, netip.Addr.Compare)
 
-	uniqueIps := []net.IP{}
+	uniqueIps := []netip.Addr{}
 	for i, ip := range ips {
-		if len(ips) > i+1 && bytes.Compare(ip, ips[i+1]) == 0 {
+		if len(ips) > i+1 && ip == ips[i+1] {
 
 		} else {
 			uniqueIps = append(uniqueIps, ip)
@@ -1204,27 +1699,27 @@ func sortIPs(ips []net.IP) []net.IP {
 }
 
 // Returns true if IPs are sorted by sortIPs()
-func ipsSorted(ips []net.IP) bool {
+func ipsSorted(ips []netip.Addr) bool {
 
-	for i, ip := range ips {
-		if i+1 < len(ips) && binary.BigEndian.Uint64(ip[0:8]) > binary.BigEndian.Uint64(ips[i+1][0:8]) {
-			return false
-		}
-		if i+1 < len(ips) && binary.BigEndian.Uint64(ip[8:16]) > binary.BigEndian.Uint64(ips[i+1][8:16]) {
-			return false
-		}
-	}
+	return slices.IsSortedFunc(ips, netip.Addr.Compare)
 
-	return true
+}
 
+// Appends a parsed IP address, invalid addresses are skipped
+func appendAddr(ips []netip.Addr, s string) []netip.Addr {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return ips
+	}
+	return append(ips, ip.Unmap())
 }
 
 // Transform a list of IPs to a list of subnets that exactly match the list of
 // IPs
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToSubnetsStrict(ips []net.IP) []net.IPNet {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToSubnetsStrict(ips []netip.Addr) []netip.Prefix {
 
-	ipNets := []net.IPNet{}
+	ipNets := []netip.Prefix{}
 
 	iAlreadyCovered := -1
 	for i, ip := range ips {
@@ -1232,17 +1727,16 @@ func ipsToSubnetsStrict(ips []net.IP) []net.IPNet {
 			continue
 		}
 
-		if ip.To4() != nil {
+		if ip.Is4() {
 			// IPv4
 			hostLen := 32
 			minParentLen := 24
 			for parentLen := minParentLen; parentLen <= hostLen; parentLen++ {
-				parentMask := net.CIDRMask(parentLen, hostLen)
-				parentNetId := ip.Mask(parentMask)
-				parentSubnet := net.IPNet{parentNetId, parentMask}
-				maxHostsInSubnet := int(math.Pow(2, float64(hostLen-parentLen)))
-				parentSubnetForAllHosts := true
-				for n := 1; n < maxHostsInSubnet; n++ {
+				parentSubnet, _ := ip.Prefix(parentLen)
+				maxHostsInSubnet := uint64(1) << (hostLen - parentLen)
+				// Subnet can not be used if fewer IPs are left than its addresses
+				parentSubnetForAllHosts := maxHostsInSubnet <= uint64(len(ips)-i)
+				for n := 1; parentSubnetForAllHosts && n < int(maxHostsInSubnet); n++ {
 					if len(ips) > i+n && parentSubnet.Contains(ips[i+n]) {
 						// Next N IP address belongs to the same subnet
 					} else {
@@ -1252,18 +1746,28 @@ func ipsToSubnetsStrict(ips []net.IP) []net.IPNet {
 				}
 				if parentSubnetForAllHosts == true {
 					ipNets = append(ipNets, parentSubnet)
-					iAlreadyCovered = i + maxHostsInSubnet - 1
+					iAlreadyCovered = i + int(maxHostsInSubnet) - 1
 					break
 				}
 			}
 		} else {
 			// IPv6
-			// Not much we can do here, don't want to go /64 for strict mode, and with
-			// autoconfigured IP addresses there is no point summarizing prefixes smaller
-			// than /64
-			parentMask := net.CIDRMask(128, 128)
-			parentSubnet := net.IPNet{ip, parentMask}
-			ipNets = append(ipNets, parentSubnet)
+			// Widest subnet aligned on this IP whose every address is on the list.
+			// IPs are sorted and unique, so the subnet is complete when the IP
+			// 2^hostBits-1 positions further is the last address of the subnet.
+			// The subnet can not hold more addresses than are left on the list,
+			// which also keeps 2^hostBits within int on 32-bit platforms.
+			start := uint128FromAddr(ip)
+			hostBits := min(start.trailingZeros(), bits.Len(uint(len(ips)-i))-1)
+			for hostBits > 0 {
+				n := 1 << hostBits
+				if uint128FromAddr(ips[i+n-1]) == start.or(hostMask(hostBits)) {
+					break
+				}
+				hostBits--
+			}
+			ipNets = append(ipNets, netip.PrefixFrom(ip, 128-hostBits))
+			iAlreadyCovered = i + 1<<hostBits - 1
 		}
 	}
 
@@ -1274,10 +1778,10 @@ func ipsToSubnetsStrict(ips []net.IP) []net.IPNet {
 // Transform a list of IPs to a minimal list of /24 or longer subnets that
 // covers all the input IPs but also some of the IPs that are not on the input
 // list
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToSubnetsLoose(ips []net.IP) []net.IPNet {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToSubnetsLoose(ips []netip.Addr, opts LooseOptions) []netip.Prefix {
 
-	ipNets := []net.IPNet{}
+	ipNets := []netip.Prefix{}
 
 	iAlreadyCovered := -1
 	for i, ip := range ips {
@@ -1285,17 +1789,16 @@ func ipsToSubnetsLoose(ips []net.IP) []net.IPNet {
 			continue
 		}
 
-		if ip.To4() != nil {
+		if ip.Is4() {
 			// IPv4
 			hostLen := 32
-			minParentLen := 24
+			minParentLen := opts.MinPrefixV4
 			previousSubnetHosts := 0
-			previousSubnet := net.IPNet{}
+			previousSubnet := netip.Prefix{}
 			for parentLen := minParentLen; parentLen <= hostLen; parentLen++ {
-				parentMask := net.CIDRMask(parentLen, hostLen)
-				parentNetId := ip.Mask(parentMask)
-				parentSubnet := net.IPNet{parentNetId, parentMask}
-				maxHostsInSubnet := int(math.Pow(2, float64(hostLen-parentLen)))
+				parentSubnet, _ := ip.Prefix(parentLen)
+				// Capped by the remaining IPs, 2^32 overflows int on 32-bit platforms
+				maxHostsInSubnet := int(min(uint64(1)<<(hostLen-parentLen), uint64(len(ips)-i)))
 				hostsInSubnet := 1
 				for n := 1; n < maxHostsInSubnet; n++ {
 					if len(ips) > i+n && parentSubnet.Contains(ips[i+n]) {
@@ -1306,6 +1809,12 @@ func ipsToSubnetsLoose(ips []net.IP) []net.IPNet {
 					}
 				}
 
+				if previousSubnetHosts == 0 && parentLen != hostLen && (opts.overcovered(hostsInSubnet, hostLen-parentLen) || excludedSubnet(parentSubnet, opts.Exclude)) {
+					// Subnet covers too many addresses not used by Agents or
+					// excluded addresses, try a narrower one
+					continue
+				}
+
 				if hostsInSubnet >= previousSubnetHosts {
 					// This subnet covers all hosts than a wider subnet, so it is a
 					// better choice
@@ -1327,28 +1836,59 @@ func ipsToSubnetsLoose(ips []net.IP) []net.IPNet {
 			}
 		} else {
 			// IPv6
-			// Simply /64 for now
+			// Widest subnet that does not cover too many addresses not used by
+			// Agents, /64 by default
 			hostLen := 128
-			parentLen := 64
-
-			parentMask := net.CIDRMask(parentLen, hostLen)
-			parentNetId := ip.Mask(parentMask)
-			parentSubnet := net.IPNet{parentNetId, parentMask}
-			hostsInSubnet := 1
-			for n := 1; n < 1000; n++ {
-				if len(ips) > i+n && parentSubnet.Contains(ips[i+n]) {
-					// Next N IP address belongs to the same subnet
-					hostsInSubnet++
-				} else {
-					break
+			for parentLen := opts.MinPrefixV6; parentLen <= hostLen; parentLen++ {
+				parentSubnet, _ := ip.Prefix(parentLen)
+				hostsInSubnet := 1
+				for n := 1; len(ips) > i+n; n++ {
+					if parentSubnet.Contains(ips[i+n]) {
+						// Next N IP address belongs to the same subnet
+						hostsInSubnet++
+					} else {
+						break
+					}
+				}
+
+				if parentLen != hostLen && (opts.overcovered(hostsInSubnet, hostLen-parentLen) || excludedSubnet(parentSubnet, opts.Exclude)) {
+					continue
 				}
-			}
 
-			ipNets = append(ipNets, parentSubnet)
-			if hostsInSubnet != 1 {
+				ipNets = append(ipNets, parentSubnet)
 				iAlreadyCovered = i + hostsInSubnet - 1
+				break
 			}
+		}
+	}
+
+	return ipNets
 
+}
+
+// Transform a list of IPs to the minimal list of subnets that exactly match the
+// list of IPs. Each IP is added as a host subnet and two sibling subnets are
+// merged into their parent subnet until no more merges are possible, which
+// yields the largest aligned subnets and therefore the minimal list.
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToSubnetsOptimal(ips []netip.Addr) []netip.Prefix {
+
+	ipNets := []netip.Prefix{}
+
+	for _, ip := range ips {
+		ipNets = append(ipNets, netip.PrefixFrom(ip, ip.BitLen()))
+
+		for len(ipNets) >= 2 {
+			last := ipNets[len(ipNets)-1]
+			previous := ipNets[len(ipNets)-2]
+			if last.Addr().Is4() != previous.Addr().Is4() || last.Bits() != previous.Bits() || last.Bits() == 0 {
+				break
+			}
+			parentSubnet, _ := previous.Addr().Prefix(last.Bits() - 1)
+			if !parentSubnet.Contains(last.Addr()) {
+				break
+			}
+			ipNets = append(ipNets[:len(ipNets)-2], parentSubnet)
 		}
 	}
 
@@ -1357,8 +1897,8 @@ func ipsToSubnetsLoose(ips []net.IP) []net.IPNet {
 }
 
 // Transform a list of IPs to a strict list of IP ranges, i.e. 10.0.0.3 - 10.0.0.5
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToIPRangesStrict(ips []net.IP) []IPRange {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToIPRangesStrict(ips []netip.Addr) []IPRange {
 
 	ipRanges := []IPRange{}
 
@@ -1377,30 +1917,17 @@ func ipsToIPRangesStrict(ips []net.IP) []IPRange {
 
 		ipRange := IPRange{ip, ip}
 
-		if ip.To4() != nil {
-			// IPv4
-			for n := 1; n < len(ips)-i; n++ {
-				if ips[i+n].To4() != nil && binary.BigEndian.Uint32(ips[i+n].To4()) == binary.BigEndian.Uint32(ip.To4())+uint32(n) {
-					ipRange.EndIP = ips[i+n]
-					iAlreadyCovered = i + n
-				} else {
-					break
-				}
-			}
-			ipRanges = append(ipRanges, ipRange)
-		} else {
-			// IPv6
-			for n := 1; n < len(ips)-i; n++ {
-				// First 64 bits have to be equal, last 64 bits must be one after another
-				if ips[i+n].To4() == nil && bytes.Compare(ips[i+n][0:8], ip[0:8]) == 0 && binary.BigEndian.Uint64(ips[i+n][8:16]) == binary.BigEndian.Uint64(ip[8:16])+uint64(n) {
-					ipRange.EndIP = ips[i+n]
-					iAlreadyCovered = i + n
-				} else {
-					break
-				}
+		// IPs of the same version must be one after another
+		start := uint128FromAddr(ip)
+		for n := 1; n < len(ips)-i; n++ {
+			if ips[i+n].Is4() == ip.Is4() && uint128FromAddr(ips[i+n]) == start.add64(uint64(n)) {
+				ipRange.EndIP = ips[i+n]
+				iAlreadyCovered = i + n
+			} else {
+				break
 			}
-			ipRanges = append(ipRanges, ipRange)
 		}
+		ipRanges = append(ipRanges, ipRange)
 	}
 
 	return ipRanges
@@ -1409,8 +1936,8 @@ func ipsToIPRangesStrict(ips []net.IP) []IPRange {
 
 // Transform a list of IPs to a loose list of IP ranges, i.e.
 // 10.0.0.3, 10.0.0.5 -> 10.0.0.3 - 10.0.0.5
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToIPRangesLoose(ips []net.IP) []IPRange {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToIPRangesLoose(ips []netip.Addr, opts LooseOptions) []IPRange {
 
 	ipRanges := []IPRange{}
 
@@ -1429,11 +1956,14 @@ func ipsToIPRangesLoose(ips []net.IP) []IPRange {
 
 		ipRange := IPRange{ip, ip}
 
-		if ip.To4() != nil {
+		if ip.Is4() {
 			// IPv4
 			for n := 1; n < len(ips)-i; n++ {
-				// IPs that are less than 255 apart are joined in a range
-				if ips[i+n].To4() != nil && binary.BigEndian.Uint32(ips[i+n].To4())-binary.BigEndian.Uint32(ip.To4()) < uint32(n*255) {
+				// IPs that are on average less than MaxGap (255 by default) apart
+				// are joined in a range
+				ipN := ips[i+n]
+				if ipN.Is4() && uint128FromAddr(ipN).sub(uint128FromAddr(ip)).lo < uint64(n)*uint64(opts.MaxGap) && !opts.overcoveredRange(n+1, ipDistance(ip, ipN)+1) &&
+					!excludedRange(ip, ipN, opts.Exclude) {
 					ipRange.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
 				} else {
@@ -1443,9 +1973,11 @@ func ipsToIPRangesLoose(ips []net.IP) []IPRange {
 			ipRanges = append(ipRanges, ipRange)
 		} else {
 			// IPv6
+			v6Subnet, _ := ip.Prefix(opts.MinPrefixV6)
 			for n := 1; n < len(ips)-i; n++ {
-				// Put anything in the same /64 subnet to the same range
-				if ips[i+n].To4() == nil && bytes.Compare(ips[i+n][0:8], ip[0:8]) == 0 {
+				// Put anything in the same /64 (MinPrefixV6) subnet to the same range
+				if v6Subnet.Contains(ips[i+n]) && !opts.overcoveredRange(n+1, ipDistance(ip, ips[i+n])+1) &&
+					!excludedRange(ip, ips[i+n], opts.Exclude) {
 					ipRange.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
 				} else {
@@ -1463,8 +1995,8 @@ func ipsToIPRangesLoose(ips []net.IP) []IPRange {
 // Transform a list of IPs to a strict list of IP blocks, i.e.
 // 10.0.0.3, 10.0.0.4 -> 10.0.0.[3-4]
 // 10.0.1.3, 10.0.2.3 -> 10.0.[1-2].3
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToIPBlocksStrict(ips []net.IP) []IPBlock {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToIPBlocksStrict(ips []netip.Addr) []IPBlock {
 
 	ipBlocks := []IPBlock{}
 
@@ -1483,17 +2015,22 @@ func ipsToIPBlocksStrict(ips []net.IP) []IPBlock {
 
 		ipBlock := IPBlock{ip, ip}
 
-		if ip.To4() != nil {
-			ip4 := ip.To4()
+		if ip.Is4() {
+			ip4 := ip.As4()
+			start := uint128FromAddr(ip)
 			// IPv4
 			for n := 1; n < len(ips)-i; n++ {
-				ipN := ips[i+n].To4()
-				if ipN != nil && binary.BigEndian.Uint32(ipN) == binary.BigEndian.Uint32(ip4)+uint32(n) {
+				if !ips[i+n].Is4() {
+					break
+				}
+				ipN := ips[i+n].As4()
+				if ip4[0] == ipN[0] && ip4[1] == ipN[1] && ip4[2] == ipN[2] && uint128FromAddr(ips[i+n]) == start.add64(uint64(n)) {
 					// D part of 2 IPs is continguos
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
-				} else if ipN != nil && uint8(ipN[2]) == uint8(ip4[2])+uint8(n) && ip4[3] == ipN[3] {
-					// C part of 2 IPs is continguos, D part is equal
+				} else if ip4[0] == ipN[0] && ip4[1] == ipN[1] && int(ipN[2]) == int(ip4[2])+n && ip4[3] == ipN[3] && (n == 1 || ipBlock.EndIP.As4()[2] != ip4[2]) {
+					// C part of 2 IPs is continguos, D part is equal, unless the block
+					// already is a range of D parts
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
 				} else {
@@ -1503,9 +2040,11 @@ func ipsToIPBlocksStrict(ips []net.IP) []IPBlock {
 			ipBlocks = append(ipBlocks, ipBlock)
 		} else {
 			// IPv6
+			start := uint128FromAddr(ip)
 			for n := 1; n < len(ips)-i; n++ {
-				// First 64 bits have to be equal, last 64 bits must be one after another
-				if ips[i+n].To4() == nil && bytes.Compare(ips[i+n][0:8], ip[0:8]) == 0 && binary.BigEndian.Uint64(ips[i+n][8:16]) == binary.BigEndian.Uint64(ip[8:16])+uint64(n) {
+				// Only the last hextet may differ and IPs must be one after another
+				ipN := uint128FromAddr(ips[i+n])
+				if ips[i+n].Is6() && start.sameHextetBlock(ipN) && ipN == start.add64(uint64(n)) {
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
 				} else {
@@ -1523,8 +2062,8 @@ func ipsToIPBlocksStrict(ips []net.IP) []IPBlock {
 // Transform a list of IPs to a loose list of IP blocks, i.e.
 // 10.0.0.3, 10.0.0.7 -> 10.0.0.[3-7]
 // 10.0.1.3, 10.0.3.3 -> 10.0.[1-3].3
-// ips []net.IP MUST be sorted by sortIPs()
-func ipsToIPBlocksLoose(ips []net.IP) []IPBlock {
+// ips []netip.Addr MUST be sorted by sortIPs()
+func ipsToIPBlocksLoose(ips []netip.Addr, opts LooseOptions) []IPBlock {
 
 	ipBlocks := []IPBlock{}
 
@@ -1543,16 +2082,21 @@ func ipsToIPBlocksLoose(ips []net.IP) []IPBlock {
 
 		ipBlock := IPBlock{ip, ip}
 
-		if ip.To4() != nil {
-			ip4 := ip.To4()
+		if ip.Is4() {
+			ip4 := ip.As4()
 			// IPv4
 			for n := 1; n < len(ips)-i; n++ {
-				ipN := ips[i+n].To4()
-				if ipN != nil && ip4[3] != ipN[3] && ip4[0] == ipN[0] && ip4[1] == ipN[1] && ip4[2] == ipN[2] {
+				if !ips[i+n].Is4() {
+					break
+				}
+				ipN := ips[i+n].As4()
+				if ip4[3] != ipN[3] && ip4[0] == ipN[0] && ip4[1] == ipN[1] && ip4[2] == ipN[2] &&
+					!opts.overcoveredRange(n+1, float64(ipN[3])-float64(ip4[3])+1) && !excludedBlock(IPBlock{ip, ips[i+n]}, opts.Exclude) {
 					// D part of 2 IPs different
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
-				} else if ipN != nil && ip4[2] != ipN[2] && ip4[0] == ipN[0] && ip4[1] == ipN[1] && ip4[3] == ipN[3] {
+				} else if ip4[2] != ipN[2] && ip4[0] == ipN[0] && ip4[1] == ipN[1] && ip4[3] == ipN[3] && (n == 1 || ipBlock.EndIP.As4()[2] != ip4[2]) &&
+					!opts.overcoveredRange(n+1, float64(ipN[2])-float64(ip4[2])+1) && !excludedBlock(IPBlock{ip, ips[i+n]}, opts.Exclude) {
 					// C part of 2 IPs different
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
@@ -1563,9 +2107,14 @@ func ipsToIPBlocksLoose(ips []net.IP) []IPBlock {
 			ipBlocks = append(ipBlocks, ipBlock)
 		} else {
 			// IPv6
+			v6Subnet, _ := ip.Prefix(opts.MinPrefixV6)
+			start := uint128FromAddr(ip)
 			for n := 1; n < len(ips)-i; n++ {
-				// First 64 bits have to be equal, last 64 bits must be one after another
-				if ips[i+n].To4() == nil && bytes.Compare(ips[i+n][0:8], ip[0:8]) == 0 {
+				// Anything in the same /64 (MinPrefixV6) subnet, where only the
+				// last hextet differs
+				if v6Subnet.Contains(ips[i+n]) && start.sameHextetBlock(uint128FromAddr(ips[i+n])) &&
+					!opts.overcoveredRange(n+1, ipDistance(ip, ips[i+n])+1) &&
+					!excludedBlock(IPBlock{ip, ips[i+n]}, opts.Exclude) {
 					ipBlock.EndIP = ips[i+n]
 					iAlreadyCovered = i + n
 				} else {
@@ -1580,115 +2129,6 @@ func ipsToIPBlocksLoose(ips []net.IP) []IPBlock {
 
 }
 
-// Returns all agents that have provided IP address
-func getAgentsByIP(agents []Agent, ip net.IP) []Agent {
-	returnAgents := []Agent{}
-
-	for _, agent := range agents {
-		if len(agent.IPv4Addresses) > 0 && ip.To4() != nil {
-			for _, aip := range agent.IPv4Addresses {
-				if bytes.Compare(ip, aip) == 0 {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		} else if len(agent.IPv6Addresses) > 0 && ip.To4() == nil {
-			for _, aip := range agent.IPv6Addresses {
-				if bytes.Compare(ip, aip) == 0 {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		}
-	}
-
-	return returnAgents
-}
-
-// Returns all agents that have an IP inside provided subnet
-func getAgentsBySubnet(agents []Agent, ipNet net.IPNet) []Agent {
-	returnAgents := []Agent{}
-
-	for _, agent := range agents {
-		if len(agent.IPv4Addresses) > 0 && ipNet.IP.To4() != nil {
-			for _, aip := range agent.IPv4Addresses {
-				if ipNet.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		} else if len(agent.IPv6Addresses) > 0 && ipNet.IP.To4() == nil {
-			for _, aip := range agent.IPv6Addresses {
-				if ipNet.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		}
-	}
-
-	return returnAgents
-}
-
-// Returns all agents that have an IP inside provided IPRange
-func getAgentsByIPRange(agents []Agent, ipRange IPRange) []Agent {
-	returnAgents := []Agent{}
-
-	for _, agent := range agents {
-		if len(agent.IPv4Addresses) > 0 && ipRange.StartIP.To4() != nil {
-			for _, aip := range agent.IPv4Addresses {
-				if ipRange.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		} else if len(agent.IPv6Addresses) > 0 && ipRange.StartIP.To4() == nil {
-			for _, aip := range agent.IPv6Addresses {
-				if ipRange.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		}
-	}
-
-	return returnAgents
-}
-
-// Returns all agents that have an IP inside provided ipBlock block
-func getAgentsByIPBlock(agents []Agent, ipBlock IPBlock) []Agent {
-	returnAgents := []Agent{}
-	for _, agent := range agents {
-		if len(agent.IPv4Addresses) > 0 && ipBlock.StartIP.To4() != nil {
-			for _, aip := range agent.IPv4Addresses {
-				if ipBlock.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-				aip4 := aip.To4()
-				sip4 := ipBlock.StartIP.To4()
-				eip4 := ipBlock.EndIP.To4()
-				if aip4 != nil && sip4 != nil && eip4 != nil &&
-					uint8(aip4[2]) >= uint8(sip4[2]) && uint8(aip4[2]) <= uint8(eip4[2]) && aip[3] == sip4[3] && aip[3] == eip4[3] {
-					// C part of 2 IPv4s is continguos, D part is equal
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-
-			}
-		} else if len(agent.IPv6Addresses) > 0 && ipBlock.StartIP.To4() == nil {
-			for _, aip := range agent.IPv6Addresses {
-				if ipBlock.Contains(aip) {
-					returnAgents = append(returnAgents, agent)
-					break
-				}
-			}
-		}
-	}
-
-	return returnAgents
-}
-
 func pad(str string, totalLen int) string {
 	var padLen int
 	if len(str) < totalLen {
@@ -1700,23 +2140,26 @@ func pad(str string, totalLen int) string {
 	return str
 }
 
-// Logger
-type Log struct{}
+// Logger, writes to Out or to standard error if Out is nil
+type Log struct {
+	Out io.Writer
+}
+
+func (log *Log) out() io.Writer {
+	if log.Out == nil {
+		return os.Stderr
+	}
+	return log.Out
+}
 
 func (log *Log) Error(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, time.Now().Format("2006-01-02 15:04:05 ")+" ERROR  "+format+"\n", a...)
+	fmt.Fprintf(log.out(), time.Now().Format("2006-01-02 15:04:05 ")+" ERROR  "+format+"\n", a...)
 }
 
-// IPSlice attaches the methods of Sort Interface to []net.IP, sorting in increasing order.
-type IPSlice []net.IP
+func (log *Log) Warn(format string, a ...interface{}) {
+	fmt.Fprintf(log.out(), time.Now().Format("2006-01-02 15:04:05 ")+" WARN   "+format+"\n", a...)
+}
 
-func (p IPSlice) Len() int { return len(p) }
-func (p IPSlice) Less(i, j int) bool {
-	c := bytes.Compare(p[i], p[j])
-	if c == -1 {
-		return true
-	} else {
-		return false
-	}
+func (log *Log) Info(format string, a ...interface{}) {
+	fmt.Fprintf(log.out(), time.Now().Format("2006-01-02 15:04:05 ")+" INFO   "+format+"\n", a...)
 }
-func (p IPSlice) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Log messages of tested functions are not printed
+func TestMain(m *testing.M) {
+	log.Out = io.Discard
+	os.Exit(m.Run())
+}
+
+func addrs(s ...string) []netip.Addr {
+	ips := []netip.Addr{}
+	for _, ip := range s {
+		ips = append(ips, netip.MustParseAddr(ip))
+	}
+	return ips
+}
+
+func prefixes(s ...string) []netip.Prefix {
+	ipNets := []netip.Prefix{}
+	for _, ipNet := range s {
+		ipNets = append(ipNets, netip.MustParsePrefix(ipNet))
+	}
+	return ipNets
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("TOKEN\n198.51.100.7\n")
+	if line, err := readLine(r); line != "TOKEN" || err != nil {
+		t.Errorf("readLine() = %q, %v, want %q", line, err, "TOKEN")
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "198.51.100.7\n" {
+		t.Errorf("input after token = %q, want %q", string(rest), "198.51.100.7\n")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+type Test struct {
+	TestID   int     `json:"testId,string"`
+	TestName string  `json:"testName"`
+	Type     string  `json:"type"`
+	Agents   []Agent `json:"agents"`
+}
+
+// Fetches tests with provided IDs and names matching all regular expressions
+// in provided Account Groups, and returns IDs of Agents assigned to them. Tests
+// and their Agents are fetched concurrently, the same way as Account Groups.
+func fetchTestAgentIDs(token string, aids []string, testIDs []int, nameRegexps []*regexp.Regexp) (map[int]bool, error) {
+
+	aidTests := make([][]Test, len(aids))
+	errs := make([]error, len(aids))
+	fetchConcurrently(len(aids), func(i int) {
+		aidTests[i], errs[i] = fetchAccountGroupTests(token, aids[i])
+	})
+
+	type aidTest struct {
+		aid  string
+		test Test
+	}
+	found := []aidTest{}
+	foundTestIDs := []int{}
+	for i, tests := range aidTests {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, test := range tests {
+			if testMatch(test, testIDs, nameRegexps) {
+				found = append(found, aidTest{aids[i], test})
+				foundTestIDs = append(foundTestIDs, test.TestID)
+			}
+		}
+	}
+
+	for _, testID := range testIDs {
+		if !slices.Contains(foundTestIDs, testID) {
+			return nil, fmt.Errorf("test %d not found", testID)
+		}
+	}
+	if len(foundTestIDs) == 0 {
+		return nil, fmt.Errorf("no tests match provided names")
+	}
+
+	testAgents := make([][]Agent, len(found))
+	errs = make([]error, len(found))
+	fetchConcurrently(len(found), func(i int) {
+		testAgents[i], errs[i] = fetchTestAgents(token, found[i].aid, found[i].test)
+	})
+
+	agentIDs := map[int]bool{}
+	for i, agents := range testAgents {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, agent := range agents {
+			agentIDs[agent.AgentID] = true
+		}
+	}
+
+	return agentIDs, nil
+
+}
+
+func testMatch(test Test, testIDs []int, nameRegexps []*regexp.Regexp) bool {
+	if len(testIDs) > 0 && !slices.Contains(testIDs, test.TestID) {
+		return false
+	}
+	for _, re := range nameRegexps {
+		if !re.MatchString(test.TestName) {
+			return false
+		}
+	}
+	return true
+}
+
+func fetchAccountGroupTests(token, aid string) ([]Test, error) {
+
+	type Tests struct {
+		Tests []Test `json:"tests"`
+	}
+
+	var tests Tests
+
+	endpoint := "/v7/tests"
+	if aid != Default {
+		endpoint = endpoint + "?aid=" + aid
+	}
+
+	response, err := apiRequest(token, endpoint)
+	if err != nil {
+		return []Test{}, err
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&tests)
+	if err != nil {
+		return []Test{}, err
+	}
+
+	return tests.Tests, nil
+
+}
+
+// Fetches Agents assigned to the test
+func fetchTestAgents(token, aid string, test Test) ([]Agent, error) {
+
+	endpoint := "/v7/tests/" + test.Type + "/" + strconv.Itoa(test.TestID) + "?expand=agent"
+	if aid != Default {
+		endpoint = endpoint + "&aid=" + aid
+	}
+
+	response, err := apiRequest(token, endpoint)
+	if err != nil {
+		return []Agent{}, err
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&test)
+	if err != nil {
+		return []Agent{}, err
+	}
+
+	return test.Agents, nil
+
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Mock API with tests 1 and 2 in the default Account Group and test 3 in
+// Account Group 20, returns the number of API requests made
+func mockTestsAPI(t *testing.T) *atomic.Int32 {
+
+	requests := &atomic.Int32{}
+	mockAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		aid := r.URL.Query().Get("aid")
+		switch {
+		case r.URL.Path == "/v7/tests" && aid == "":
+			fmt.Fprint(w, `{"tests": [{"testId": "1", "testName": "web-eu", "type": "http-server"}, {"testId": "2", "testName": "dns-us", "type": "dns-server"}]}`)
+		case r.URL.Path == "/v7/tests" && aid == "20":
+			fmt.Fprint(w, `{"tests": [{"testId": "3", "testName": "web-us", "type": "http-server"}]}`)
+		case r.URL.Query().Get("expand") != "agent":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/v7/tests/http-server/1" && aid == "":
+			fmt.Fprint(w, `{"testId": "1", "agents": [{"agentId": "10"}, {"agentId": "11"}]}`)
+		case r.URL.Path == "/v7/tests/dns-server/2" && aid == "":
+			fmt.Fprint(w, `{"testId": "2", "agents": [{"agentId": "11"}, {"agentId": "12"}]}`)
+		case r.URL.Path == "/v7/tests/http-server/3" && aid == "20":
+			fmt.Fprint(w, `{"testId": "3", "agents": [{"agentId": "13"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return requests
+
+}
+
+func TestFetchTestAgentIDs(t *testing.T) {
+
+	requests := mockTestsAPI(t)
+
+	tests := []struct {
+		aids        []string
+		testIDs     []int
+		names       []string
+		agentIDs    []int
+		err         string
+		apiRequests int32
+	}{
+		{aids: []string{Default}, testIDs: []int{1}, agentIDs: []int{10, 11}, apiRequests: 2},
+		{aids: []string{Default}, testIDs: []int{1, 2}, agentIDs: []int{10, 11, 12}, apiRequests: 3},
+		{aids: []string{Default}, names: []string{"^web"}, agentIDs: []int{10, 11}, apiRequests: 2},
+		{aids: []string{Default, "20"}, names: []string{"^web"}, agentIDs: []int{10, 11, 13}, apiRequests: 4},
+		{aids: []string{Default, "20"}, testIDs: []int{1, 3}, names: []string{"web"}, agentIDs: []int{10, 11, 13}, apiRequests: 4},
+		// Agents of tests are not fetched when any test is missing
+		{aids: []string{Default}, testIDs: []int{1, 3}, err: "test 3 not found", apiRequests: 1},
+		{aids: []string{Default, "20"}, testIDs: []int{2}, names: []string{"web"}, err: "test 2 not found", apiRequests: 2},
+		{aids: []string{Default}, names: []string{"^tcp"}, err: "no tests match provided names", apiRequests: 1},
+		{aids: []string{"30"}, names: []string{"web"}, err: "404 Not Found", apiRequests: 1},
+	}
+
+	for _, test := range tests {
+		nameRegexps := []*regexp.Regexp{}
+		for _, name := range test.names {
+			nameRegexps = append(nameRegexps, regexp.MustCompile(name))
+		}
+		requests.Store(0)
+
+		agentIDs, err := fetchTestAgentIDs("token", test.aids, test.testIDs, nameRegexps)
+
+		desc := fmt.Sprintf("fetchTestAgentIDs(%v, %v, %v)", test.aids, test.testIDs, test.names)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s error = %v, want %q", desc, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s error = %v", desc, err)
+		} else if got := slices.Sorted(maps.Keys(agentIDs)); !slices.Equal(got, test.agentIDs) {
+			t.Errorf("%s = %v, want %v", desc, got, test.agentIDs)
+		}
+		if n := requests.Load(); n != test.apiRequests {
+			t.Errorf("%s made %d API requests, want %d", desc, n, test.apiRequests)
+		}
+	}
+
+}
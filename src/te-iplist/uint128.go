@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"net/netip"
+)
+
+// 128-bit unsigned integer used for IP address arithmetic. IPv4 addresses are
+// stored in their IPv4-mapped IPv6 form, so the last 32 bits hold the address.
+type uint128 struct {
+	hi, lo uint64
+}
+
+func uint128FromAddr(ip netip.Addr) uint128 {
+	b := ip.As16()
+	return uint128{binary.BigEndian.Uint64(b[0:8]), binary.BigEndian.Uint64(b[8:16])}
+}
+
+// Address of the provided version, is4 must match the version u was created from
+func (u uint128) addr(is4 bool) netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], u.hi)
+	binary.BigEndian.PutUint64(b[8:16], u.lo)
+	if is4 {
+		return netip.AddrFrom16(b).Unmap()
+	}
+	return netip.AddrFrom16(b)
+}
+
+func (u uint128) add64(n uint64) uint128 {
+	lo, carry := bits.Add64(u.lo, n, 0)
+	return uint128{u.hi + carry, lo}
+}
+
+// Sum of u and v, or the largest uint128 if the sum overflows
+func (u uint128) addSat(v uint128) uint128 {
+	lo, carry := bits.Add64(u.lo, v.lo, 0)
+	hi, carry := bits.Add64(u.hi, v.hi, carry)
+	if carry != 0 {
+		return hostMask(128)
+	}
+	return uint128{hi, lo}
+}
+
+func (u uint128) sub(v uint128) uint128 {
+	lo, borrow := bits.Sub64(u.lo, v.lo, 0)
+	return uint128{u.hi - v.hi - borrow, lo}
+}
+
+func (u uint128) or(v uint128) uint128 {
+	return uint128{u.hi | v.hi, u.lo | v.lo}
+}
+
+func (u uint128) xor(v uint128) uint128 {
+	return uint128{u.hi ^ v.hi, u.lo ^ v.lo}
+}
+
+func (u uint128) cmp(v uint128) int {
+	if u.hi < v.hi || (u.hi == v.hi && u.lo < v.lo) {
+		return -1
+	} else if u == v {
+		return 0
+	}
+	return 1
+}
+
+func (u uint128) float64() float64 {
+	return math.Ldexp(float64(u.hi), 64) + float64(u.lo)
+}
+
+// Number of trailing zero bits, 128 for zero
+func (u uint128) trailingZeros() int {
+	if u.lo != 0 {
+		return bits.TrailingZeros64(u.lo)
+	}
+	return 64 + bits.TrailingZeros64(u.hi)
+}
+
+// Number of leading zero bits, 128 for zero
+func (u uint128) leadingZeros() int {
+	if u.hi != 0 {
+		return bits.LeadingZeros64(u.hi)
+	}
+	return 64 + bits.LeadingZeros64(u.lo)
+}
+
+// Returns true if u and v differ only in the last 16 bits, the last hextet of
+// an IPv6 address
+func (u uint128) sameHextetBlock(v uint128) bool {
+	return u.hi == v.hi && u.lo>>16 == v.lo>>16
+}
+
+// uint128 with n lowest bits set
+func hostMask(n int) uint128 {
+	if n <= 0 {
+		return uint128{}
+	} else if n < 64 {
+		return uint128{0, 1<<n - 1}
+	} else if n < 128 {
+		return uint128{1<<(n-64) - 1, math.MaxUint64}
+	}
+	return uint128{math.MaxUint64, math.MaxUint64}
+}
+
+// Last address in the subnet
+func lastAddr(ipNet netip.Prefix) netip.Addr {
+	ip := ipNet.Masked().Addr()
+	return uint128FromAddr(ip).or(hostMask(ip.BitLen() - ipNet.Bits())).addr(ip.Is4())
+}